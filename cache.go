@@ -0,0 +1,291 @@
+package gogoogledm
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Cache stores the elements of origin and destination pairs, so that they
+// are not requested again. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the element stored for key, if any and not expired.
+	Get(key string) (CachedElement, bool)
+	// Set stores element for key, for ttl. A zero ttl never expires.
+	Set(key string, element CachedElement, ttl time.Duration)
+}
+
+// CachedElement is the element of an origin and destination pair, along
+// with their addresses as returned by Google.
+type CachedElement struct {
+	OriginAddress      string     `json:"origin_address"`
+	DestinationAddress string     `json:"destination_address"`
+	Element            ApiElement `json:"element"`
+}
+
+// cacheable reports whether the elements of a request are looked up and
+// stored in the cache. Without slots, departing now is never the same
+// departure time again, so its elements would never be hit.
+func (api *DistanceMatrixAPI) cacheable(opts *RequestOptions) bool {
+	return api.cache != nil && (api.departureSlot > 0 || opts == nil || !opts.DepartureNow)
+}
+
+// cacheKeyPrefix returns the part of the cache keys shared by the pairs of a
+// request: everything that changes the element but the origin and destination.
+func (api *DistanceMatrixAPI) cacheKeyPrefix(transportMode TransportMode, opts *RequestOptions) string {
+	params := api.buildUrlParams(transportMode, opts)
+	if api.departureSlot > 0 && opts != nil && opts.hasDepartureTime() {
+		departureTime := opts.DepartureTime
+		if opts.DepartureNow {
+			departureTime = time.Now()
+		}
+		params.Set("departure_time", api.departureBucket(departureTime))
+	}
+
+	return params.Encode()
+}
+
+// departureBucket returns the weekday and the start of the departure slot
+// of t, for instance "Monday-08:30" for 15 minute slots.
+func (api *DistanceMatrixAPI) departureBucket(t time.Time) string {
+	// The slots follow the wall clock, whatever the daylight saving time.
+	t = t.In(api.departureLocation)
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	slotStart := sinceMidnight / api.departureSlot * api.departureSlot
+
+	return fmt.Sprintf("%s-%02d:%02d", t.Weekday(), int(slotStart.Hours()), int(slotStart.Minutes())%60)
+}
+
+// cacheTTLFor returns the time the elements of a request are cached for.
+func (api *DistanceMatrixAPI) cacheTTLFor(transportMode TransportMode, opts *RequestOptions) time.Duration {
+	if api.hasTrafficCacheTTL && opts.hasTraffic(transportMode) {
+		return api.trafficCacheTTL
+	}
+	return api.cacheTTL
+}
+
+func (api *DistanceMatrixAPI) cacheKey(prefix string, origin Location, destination Location) string {
+	if api.cacheQuantizer != nil {
+		origin = api.cacheQuantizer.Quantize(origin)
+		destination = api.cacheQuantizer.Quantize(destination)
+	}
+
+	return prefix + "|" + origin.String() + "|" + destination.String()
+}
+
+// cacheMiss is a set of origins missing the same destinations from the cache,
+// which are requested together.
+type cacheMiss struct {
+	origins      []int
+	destinations []int
+}
+
+// getCachedDistances takes the pairs found in the cache, requests the others
+// and stores them in the cache.
+func (api *DistanceMatrixAPI) getCachedDistances(ctx context.Context, origins []Location, destinations []Location, transportMode TransportMode, opts *RequestOptions) (*ApiResponse, error) {
+	if err := opts.validate(transportMode); err != nil {
+		return nil, err
+	}
+
+	prefix := api.cacheKeyPrefix(transportMode, opts)
+	ttl := api.cacheTTLFor(transportMode, opts)
+	joinedResponse := newApiResponse(len(origins), len(destinations))
+	joinedResponse.Status = "OK"
+
+	var misses []*cacheMiss
+	missesByDestinations := make(map[string]*cacheMiss)
+	for i, o := range origins {
+		var missing []int
+		for j, d := range destinations {
+			cached, ok := api.cache.Get(api.cacheKey(prefix, o, d))
+			if !ok {
+				missing = append(missing, j)
+				continue
+			}
+
+			joinedResponse.Rows[i].Elements[j] = cached.Element
+			joinedResponse.OriginAddresses[i] = cached.OriginAddress
+			joinedResponse.DestinationAddresses[j] = cached.DestinationAddress
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		key := fmt.Sprint(missing)
+		miss, ok := missesByDestinations[key]
+		if !ok {
+			miss = &cacheMiss{destinations: missing}
+			missesByDestinations[key] = miss
+			misses = append(misses, miss)
+		}
+		miss.origins = append(miss.origins, i)
+	}
+
+	// The calls of every miss are planned and sent together, so that they
+	// share the concurrency and the deadline of the request.
+	var (
+		apiCalls   []ApiCall
+		callMisses []*cacheMiss
+	)
+	for _, miss := range misses {
+		missCalls, err := api.planCalls(pickLocations(origins, miss.origins), pickLocations(destinations, miss.destinations), transportMode, opts)
+		if err != nil {
+			return nil, err
+		}
+		apiCalls = append(apiCalls, missCalls...)
+		for range missCalls {
+			callMisses = append(callMisses, miss)
+		}
+	}
+	plan, err := api.newQueryPlan(apiCalls, transportMode, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, callErrs, err := api.send(ctx, plan, transportMode, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var partialErr PartialError
+	for c, call := range apiCalls {
+		miss := callMisses[c]
+		if callErrs[c] != nil {
+			partialErr.Failed = append(partialErr.Failed, miss.callErrorInRequest(newCallError(call, callErrs[c])))
+			continue
+		}
+
+		resp := responses[c]
+		for k, row := range resp.Rows {
+			i := miss.origins[call.OriginOffset+k]
+			for l, element := range row.Elements {
+				j := miss.destinations[call.DestinationOffset+l]
+				joinedResponse.Rows[i].Elements[j] = element
+				if element.Status == string(ElementOK) {
+					api.cache.Set(api.cacheKey(prefix, origins[i], destinations[j]), CachedElement{
+						OriginAddress:      resp.OriginAddresses[k],
+						DestinationAddress: resp.DestinationAddresses[l],
+						Element:            element,
+					}, ttl)
+				}
+			}
+		}
+		for k, address := range resp.OriginAddresses {
+			joinedResponse.OriginAddresses[miss.origins[call.OriginOffset+k]] = address
+		}
+		for l, address := range resp.DestinationAddresses {
+			joinedResponse.DestinationAddresses[miss.destinations[call.DestinationOffset+l]] = address
+		}
+	}
+
+	if len(partialErr.Failed) > 0 {
+		partialErr.Calls = len(apiCalls)
+		return joinedResponse, &partialErr
+	}
+	return joinedResponse, nil
+}
+
+// callErrorInRequest maps the indexes of a call error of the miss to the
+// indexes of the request.
+func (miss *cacheMiss) callErrorInRequest(f CallError) CallError {
+	originIndexes := make([]int, len(f.originIndexes))
+	for k, i := range f.originIndexes {
+		originIndexes[k] = miss.origins[i]
+	}
+	destinationIndexes := make([]int, len(f.destinationIndexes))
+	for l, j := range f.destinationIndexes {
+		destinationIndexes[l] = miss.destinations[j]
+	}
+
+	f.originIndexes = originIndexes
+	f.destinationIndexes = destinationIndexes
+	return f
+}
+
+func pickLocations(locations []Location, indexes []int) []Location {
+	picked := make([]Location, len(indexes))
+	for k, i := range indexes {
+		picked[k] = locations[i]
+	}
+	return picked
+}
+
+// LRUCache is an in-memory Cache holding up to a fixed number of elements,
+// evicting the least recently used ones first.
+type LRUCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	entries *list.List
+	keys    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	element   CachedElement
+	expiresAt time.Time
+}
+
+// NewLRUCache returns an LRUCache holding up to capacity elements.
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		entries:  list.New(),
+		keys:     make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) (CachedElement, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.keys[key]
+	if !ok {
+		return CachedElement{}, false
+	}
+
+	entry := e.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.entries.Remove(e)
+		delete(c.keys, key)
+		return CachedElement{}, false
+	}
+
+	c.entries.MoveToFront(e)
+	return entry.element, true
+}
+
+func (c *LRUCache) Set(key string, element CachedElement, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if e, ok := c.keys[key]; ok {
+		entry := e.Value.(*lruEntry)
+		entry.element = element
+		entry.expiresAt = expiresAt
+		c.entries.MoveToFront(e)
+		return
+	}
+
+	c.keys[key] = c.entries.PushFront(&lruEntry{key: key, element: element, expiresAt: expiresAt})
+	for c.entries.Len() > c.capacity {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.keys, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Len returns the number of elements in the cache, expired ones included
+// until they are looked up or evicted.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Len()
+}
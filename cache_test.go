@@ -0,0 +1,346 @@
+package gogoogledm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Set("a", CachedElement{OriginAddress: "a"}, 0)
+	cache.Set("b", CachedElement{OriginAddress: "b"}, 0)
+
+	// a is now the most recently used, b is evicted
+	if e, ok := cache.Get("a"); !ok || e.OriginAddress != "a" {
+		t.Error("a should be cached")
+	}
+	cache.Set("c", CachedElement{OriginAddress: "c"}, 0)
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 elements, got %d", cache.Len())
+	}
+
+	cache.Set("d", CachedElement{}, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := cache.Get("d"); ok {
+		t.Error("d should have expired")
+	}
+}
+
+// pairsRecorder records the pairs requested to distanceMatrixHandler.
+type pairsRecorder struct {
+	mu    sync.Mutex
+	pairs []string
+	calls int
+}
+
+func (rec *pairsRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.mu.Lock()
+	rec.calls++
+	for _, o := range strings.Split(r.URL.Query().Get("origins"), "|") {
+		for _, d := range strings.Split(r.URL.Query().Get("destinations"), "|") {
+			rec.pairs = append(rec.pairs, o+" -> "+d)
+		}
+	}
+	rec.mu.Unlock()
+
+	distanceMatrixHandler(w, r)
+}
+
+func (rec *pairsRecorder) reset() (pairs []string, calls int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	pairs, calls = rec.pairs, rec.calls
+	rec.pairs, rec.calls = nil, 0
+	return pairs, calls
+}
+
+func TestGetDistancesWithCache(t *testing.T) {
+	rec := &pairsRecorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithCache(NewLRUCache(100), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origins := []Location{Address("origin 0"), Address("origin 1")}
+	destinations := []Location{Address("destination 0"), Address("destination 1")}
+	if _, err := api.GetDistancesWithOptions(context.Background(), origins, destinations, Driving, nil); err != nil {
+		t.Fatal(err)
+	}
+	if pairs, _ := rec.reset(); len(pairs) != 4 {
+		t.Errorf("Expected 4 pairs requested, got %v", pairs)
+	}
+
+	// Only the pairs of the new origin and destination are requested, the
+	// origins missing only the new destination in a single call.
+	origins = append(origins, Address("origin 2"))
+	destinations = append(destinations, Address("destination 2"))
+	resp, err := api.GetDistancesWithOptions(context.Background(), origins, destinations, Driving, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs, calls := rec.reset()
+	if len(pairs) != 5 || calls != 2 {
+		t.Errorf("Expected 5 pairs requested in 2 calls, got %v in %d calls", pairs, calls)
+	}
+	for i, r := range resp.Rows {
+		for j, e := range r.Elements {
+			if e.Distance.Text != origins[i].String()+" -> "+destinations[j].String() {
+				t.Errorf("Element %d,%d is not at its place", i, j)
+			}
+		}
+	}
+	if resp.OriginAddresses[0] != "origin 0" || resp.DestinationAddresses[2] != "destination 2" {
+		t.Error("Addresses are not as expected")
+	}
+
+	// Other options are other pairs
+	if _, err := api.GetDistancesWithOptions(context.Background(), origins[:1], destinations[:1], Walking, nil); err != nil {
+		t.Fatal(err)
+	}
+	if pairs, _ := rec.reset(); len(pairs) != 1 {
+		t.Errorf("Expected the walking pair to be requested, got %v", pairs)
+	}
+}
+
+func TestGetMatrixPartiallyWithCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("origins") == "origin 2" {
+			w.Write([]byte(`{"status": "UNKNOWN_ERROR"}`))
+			return
+		}
+		distanceMatrixHandler(w, r)
+	}))
+	defer server.Close()
+
+	cache := NewLRUCache(100)
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithCache(cache, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.maxElementsPerRequest = 1
+
+	origins := []Location{Address("origin 0"), Address("origin 1"), Address("origin 2")}
+	destinations := []Location{Address("destination 0"), Address("destination 1")}
+	if _, err := api.GetMatrix(context.Background(), origins[:2], destinations[1:], Driving, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	matrix, err := api.GetMatrix(context.Background(), origins, destinations, Driving, &RequestOptions{Partial: true})
+	if !errors.Is(err, ErrUnkownError) {
+		t.Fatalf("Expected an unknown error, got %v", err)
+	}
+
+	failures := matrix.Failures()
+	if len(failures) != 2 || failures[0].OriginIndex != 2 || failures[1].OriginIndex != 2 {
+		t.Errorf("Expected the row of origin 2 to fail, got %v", failures)
+	}
+	if cache.Len() != 4 {
+		t.Errorf("Expected the 4 elements of the successful calls to be cached, got %d", cache.Len())
+	}
+}
+
+func TestDepartureBucket(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	api, err := New(WithAPIKey("key"), WithDepartureSlots(15*time.Minute, paris))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		departureTime time.Time
+		expected      string
+	}{
+		{time.Date(2030, 3, 4, 8, 44, 59, 0, paris), "Monday-08:30"},
+		{time.Date(2030, 3, 4, 7, 50, 0, 0, time.UTC), "Monday-08:45"},
+		{time.Date(2030, 3, 31, 3, 10, 0, 0, paris), "Sunday-03:00"},
+		{time.Date(2030, 3, 9, 23, 59, 0, 0, paris), "Saturday-23:45"},
+	}
+	for _, test := range tests {
+		if bucket := api.departureBucket(test.departureTime); bucket != test.expected {
+			t.Errorf("Expected %s for %s, got %s", test.expected, test.departureTime, bucket)
+		}
+	}
+
+	if _, err := New(WithAPIKey("key"), WithDepartureSlots(0, nil)); err != ErrInvalidDepartureSlot {
+		t.Errorf("Expected an invalid departure slot error, got %v", err)
+	}
+}
+
+// ttlCache records the ttl of the elements set.
+type ttlCache struct {
+	*LRUCache
+	ttls []time.Duration
+}
+
+func (c *ttlCache) Set(key string, element CachedElement, ttl time.Duration) {
+	c.ttls = append(c.ttls, ttl)
+	c.LRUCache.Set(key, element, ttl)
+}
+
+func TestGetDistancesWithDepartureSlots(t *testing.T) {
+	rec := &pairsRecorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	cache := &ttlCache{LRUCache: NewLRUCache(100)}
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL),
+		WithCache(cache, 24*time.Hour), WithTrafficCacheTTL(time.Hour), WithDepartureSlots(15*time.Minute, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origins := []Location{Address("origin")}
+	destinations := []Location{Address("destination")}
+	monday := time.Date(2030, 3, 4, 8, 0, 0, 0, time.UTC)
+	departureTimes := []time.Time{
+		monday.Add(time.Minute),
+		monday.Add(14 * time.Minute),           // same slot
+		monday.Add(7 * 24 * time.Hour),         // same slot of the next monday
+		monday.Add(15 * time.Minute),           // next slot
+		monday.Add(24*time.Hour + time.Minute), // tuesday
+	}
+	expectedCalls := []int{1, 0, 0, 1, 1}
+
+	for i, departureTime := range departureTimes {
+		opts := &RequestOptions{DepartureTime: departureTime}
+		if _, err := api.GetDistancesWithOptions(context.Background(), origins, destinations, Driving, opts); err != nil {
+			t.Fatal(err)
+		}
+		if _, calls := rec.reset(); calls != expectedCalls[i] {
+			t.Errorf("Expected %d calls departing at %s, got %d", expectedCalls[i], departureTime, calls)
+		}
+	}
+
+	// Free-flow elements are cached with the ttl of WithCache
+	if _, err := api.GetDistancesWithOptions(context.Background(), origins, destinations, Driving, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectedTTLs := []time.Duration{time.Hour, time.Hour, time.Hour, 24 * time.Hour}
+	if !reflect.DeepEqual(cache.ttls, expectedTTLs) {
+		t.Errorf("Expected ttls %v, got %v", expectedTTLs, cache.ttls)
+	}
+}
+
+// newScatteredMissesAPI returns an api whose cache holds the diagonal of a
+// 3x3 matrix, so that every origin misses different destinations.
+func newScatteredMissesAPI(t *testing.T, serverURL string, opts ...Option) (*DistanceMatrixAPI, []Location, []Location) {
+	cache := NewLRUCache(100)
+	api, err := New(append([]Option{WithAPIKey("key"), WithBaseURL(serverURL), WithCache(cache, 0)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origins := []Location{Address("origin 0"), Address("origin 1"), Address("origin 2")}
+	destinations := []Location{Address("destination 0"), Address("destination 1"), Address("destination 2")}
+	prefix := api.cacheKeyPrefix(Driving, nil)
+	for i := range origins {
+		cache.Set(api.cacheKey(prefix, origins[i], destinations[i]), testCachedElement("cached"), 0)
+	}
+
+	return api, origins, destinations
+}
+
+func TestGetDistancesWithCacheSendsMissesConcurrently(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		distanceMatrixHandler(w, r)
+	}))
+	defer server.Close()
+
+	api, origins, destinations := newScatteredMissesAPI(t, server.URL, WithConcurrency(3))
+	resp, err := api.GetDistancesWithOptions(context.Background(), origins, destinations, Driving, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&maxInFlight) != 3 {
+		t.Errorf("Expected the 3 misses in flight, got %d", atomic.LoadInt32(&maxInFlight))
+	}
+	for i, r := range resp.Rows {
+		for j, e := range r.Elements {
+			expected := origins[i].String() + " -> " + destinations[j].String()
+			if i == j {
+				expected = "cached"
+			}
+			if e.Distance.Text != expected {
+				t.Errorf("Element %d,%d is not at its place", i, j)
+			}
+		}
+	}
+}
+
+func TestGetDistancesWithCacheFailsFastForAllMisses(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		distanceMatrixHandler(w, r)
+	}))
+	defer server.Close()
+
+	// Every miss fits in the rate limit, but the 3 of them need 2s
+	api, origins, destinations := newScatteredMissesAPI(t, server.URL, WithRateLimit(2, time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if _, err := api.GetDistancesWithOptions(ctx, origins, destinations, Driving, nil); err != ErrRateLimitExceedsDeadline {
+		t.Errorf("Expected the rate limit to exceed the deadline, got %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Error("No call should have been sent")
+	}
+}
+
+func TestGetDistancesDepartingNowWithoutSlots(t *testing.T) {
+	rec := &pairsRecorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	cache := NewLRUCache(100)
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithCache(cache, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origins := []Location{Address("origin")}
+	destinations := []Location{Address("destination")}
+	opts := &RequestOptions{DepartureNow: true}
+	for i := 0; i < 2; i++ {
+		if _, err := api.GetDistancesWithOptions(context.Background(), origins, destinations, Driving, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Departing now is another departure time at every request
+	if _, calls := rec.reset(); calls != 2 {
+		t.Errorf("Expected both requests departing now to be sent, got %d calls", calls)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Expected the elements departing now not to be cached, got %d", cache.Len())
+	}
+}
@@ -0,0 +1,302 @@
+package gogoogledm
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingCredentials      = errors.New("an api key or a client id and signing key are required")
+	ErrConflictingCredentials  = errors.New("an api key and a client id cannot both be used")
+	ErrChannelRequiresClientID = errors.New("channel is only supported with a client id")
+	ErrUnknownAccountType      = errors.New("unknown account type")
+	ErrUnknownUnitSystem       = errors.New("unknown unit system")
+	ErrInvalidRateLimit        = errors.New("rate limit elements and window must be positive")
+	ErrNilHTTPClient           = errors.New("http client cannot be nil")
+	ErrNilRateLimiter          = errors.New("rate limiter cannot be nil")
+	ErrNilStore                = errors.New("store cannot be nil")
+	ErrInvalidConcurrency      = errors.New("concurrency must be at least 1")
+	ErrNilCache                = errors.New("cache cannot be nil")
+	ErrNilQuantizer            = errors.New("quantizer cannot be nil")
+	ErrInvalidDepartureSlot    = errors.New("departure slot must be positive and at most 24 hours")
+)
+
+// Option configures a DistanceMatrixAPI created with New.
+type Option func(api *DistanceMatrixAPI) error
+
+// New creates a DistanceMatrixAPI. Credentials are required, either with
+// WithAPIKey or WithClientIDAndSigningKey. Unless configured otherwise, the
+// limits are the ones of a FreeAccount, and the language and units are left
+// for Google to pick.
+func New(opts ...Option) (*DistanceMatrixAPI, error) {
+	api := newDistanceMatrixAPI()
+	for _, opt := range opts {
+		if err := opt(api); err != nil {
+			return nil, err
+		}
+	}
+
+	if api.maxElementsPerRequest == 0 {
+		if err := api.setAccountType(FreeAccount); err != nil {
+			return nil, err
+		}
+	}
+	if api.limiter == nil {
+		api.limiter = api.defaultRateLimiter()
+	}
+
+	if api.apiKey == "" && api.clientID == "" {
+		return nil, ErrMissingCredentials
+	}
+	if api.apiKey != "" && api.clientID != "" {
+		return nil, ErrConflictingCredentials
+	}
+	if api.channel != "" && api.clientID == "" {
+		return nil, ErrChannelRequiresClientID
+	}
+
+	return api, nil
+}
+
+// WithAPIKey authenticates the requests with an API key.
+func WithAPIKey(apiKey string) Option {
+	return func(api *DistanceMatrixAPI) error {
+		api.apiKey = apiKey
+		return nil
+	}
+}
+
+// WithClientIDAndSigningKey authenticates the requests with a client ID and
+// signs them. The signing key is URL modified Base64 encoded, as provided by Google.
+func WithClientIDAndSigningKey(clientID string, signingKey string) Option {
+	return func(api *DistanceMatrixAPI) error {
+		decodedCryptoKey, err := base64.URLEncoding.DecodeString(signingKey)
+		if err != nil {
+			return err
+		}
+
+		api.clientID = clientID
+		api.cryptoKey = decodedCryptoKey
+		return nil
+	}
+}
+
+// WithChannel sets the channel used to track usage, with a client ID only.
+func WithChannel(channel string) Option {
+	return func(api *DistanceMatrixAPI) error {
+		api.channel = channel
+		return nil
+	}
+}
+
+// WithAccountType sets the limits of the account, FreeAccount by default.
+func WithAccountType(accountType AccountType) Option {
+	return func(api *DistanceMatrixAPI) error {
+		return api.setAccountType(accountType)
+	}
+}
+
+// WithLanguage sets the language of the addresses and texts in the responses.
+// Codes are available here https://developers.google.com/maps/faq#languagesupport
+func WithLanguage(languageCode string) Option {
+	return func(api *DistanceMatrixAPI) error {
+		api.languageCode = languageCode
+		return nil
+	}
+}
+
+// WithUnits sets the unit system of the texts in the responses.
+func WithUnits(unitSystem UnitSystem) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if unitSystem != MetricUnit && unitSystem != ImperialUnit {
+			return ErrUnknownUnitSystem
+		}
+
+		api.unitSystem = unitSystem
+		return nil
+	}
+}
+
+// WithHTTPClient sets the client used to send the requests, http.DefaultClient by default.
+func WithHTTPClient(client *http.Client) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if client == nil {
+			return ErrNilHTTPClient
+		}
+
+		api.httpClient = client
+		return nil
+	}
+}
+
+// WithBaseURL sets the scheme and host the requests are sent to,
+// https://maps.googleapis.com by default.
+func WithBaseURL(baseURL string) Option {
+	return func(api *DistanceMatrixAPI) error {
+		api.baseURL = strings.TrimSuffix(baseURL, "/")
+		return nil
+	}
+}
+
+// WithLogger logs the throttling of the requests to logger.
+func WithLogger(logger *log.Logger) Option {
+	return func(api *DistanceMatrixAPI) error {
+		api.logger = logger
+		return nil
+	}
+}
+
+// WithRateLimit overrides the number of elements sent per window of time
+// set by the account type.
+func WithRateLimit(elements int, window time.Duration) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if elements <= 0 || window <= 0 {
+			return ErrInvalidRateLimit
+		}
+
+		api.elementsPerWindow = elements
+		api.window = window
+		return nil
+	}
+}
+
+// WithRateLimiter replaces the default rate limiter, built from the account
+// type limits, for instance to share one between several clients.
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if limiter == nil {
+			return ErrNilRateLimiter
+		}
+
+		api.limiter = limiter
+		return nil
+	}
+}
+
+// WithSharedStore coordinates the account limits across every process
+// using store, with a rate limiter created by NewDistributedRateLimiter.
+// The counters of the store are prefixed with key.
+func WithSharedStore(store Store, key string) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if store == nil {
+			return ErrNilStore
+		}
+
+		api.store = store
+		api.storeKey = key
+		return nil
+	}
+}
+
+// WithRetryPolicy retries the calls failing with an error for which
+// IsRetryable is true. Calls are not retried by default, DefaultRetryPolicy
+// is a sensible choice.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+
+		api.retryPolicy = policy
+		return nil
+	}
+}
+
+// WithConcurrency sends up to concurrency calls of a request in parallel,
+// still within the rate limit. Calls are sent one at a time by default.
+func WithConcurrency(concurrency int) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if concurrency < 1 {
+			return ErrInvalidConcurrency
+		}
+
+		api.concurrency = concurrency
+		return nil
+	}
+}
+
+// WithCache looks up the pairs of a request in cache before sending it, and
+// stores the elements fetched with a status OK for ttl. A zero ttl keeps them
+// until the cache evicts them.
+func WithCache(cache Cache, ttl time.Duration) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if cache == nil {
+			return ErrNilCache
+		}
+
+		api.cache = cache
+		api.cacheTTL = ttl
+		return nil
+	}
+}
+
+// WithTrafficCacheTTL stores the elements fetched with traffic, that is for
+// driving requests with a departure time, for ttl rather than for the ttl of
+// WithCache. A zero ttl keeps them until the cache evicts them.
+func WithTrafficCacheTTL(ttl time.Duration) Option {
+	return func(api *DistanceMatrixAPI) error {
+		api.trafficCacheTTL = ttl
+		api.hasTrafficCacheTTL = true
+		return nil
+	}
+}
+
+// WithDepartureSlots buckets the departure times of the cache keys in slots
+// of slot per weekday, in the time zone of location, UTC if nil. Requests
+// departing in the same slot of the same weekday then share their cached
+// elements, those departing now included. Without slots, a departure time
+// is only cached for requests with the exact same departure time, and the
+// requests departing now bypass the cache.
+func WithDepartureSlots(slot time.Duration, location *time.Location) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if slot <= 0 || slot > 24*time.Hour {
+			return ErrInvalidDepartureSlot
+		}
+		if location == nil {
+			location = time.UTC
+		}
+
+		api.departureSlot = slot
+		api.departureLocation = location
+		return nil
+	}
+}
+
+// WithCacheQuantizer snaps the coordinates of the cache keys with quantizer,
+// so that close coordinates share their cached elements. The coordinates
+// sent to Google are left unchanged.
+// An invalid PrecisionQuantizer or GeohashQuantizer returns ErrInvalidQuantizer.
+func WithCacheQuantizer(quantizer Quantizer) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if err := validateQuantizer(quantizer); err != nil {
+			return err
+		}
+
+		api.cacheQuantizer = quantizer
+		return nil
+	}
+}
+
+// WithRequestQuantizer snaps the coordinates of the requests with quantizer
+// before planning and sending them or looking them up in the cache.
+// An invalid PrecisionQuantizer or GeohashQuantizer returns ErrInvalidQuantizer.
+func WithRequestQuantizer(quantizer Quantizer) Option {
+	return func(api *DistanceMatrixAPI) error {
+		if err := validateQuantizer(quantizer); err != nil {
+			return err
+		}
+
+		api.requestQuantizer = quantizer
+		return nil
+	}
+}
+
+func (api *DistanceMatrixAPI) logf(format string, v ...interface{}) {
+	if api.logger != nil {
+		api.logger.Printf("gogoogledm: "+format, v...)
+	}
+}
@@ -0,0 +1,98 @@
+package gogoogledm
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	client := &http.Client{Timeout: time.Second}
+	api, err := New(
+		WithAPIKey("key"),
+		WithRateLimit(50, time.Second),
+		WithAccountType(GoogleForWorkAccount),
+		WithLanguage("fr"),
+		WithUnits(MetricUnit),
+		WithHTTPClient(client),
+		WithBaseURL("http://localhost:8080/"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if api.maxElementsPerRequest != 625 {
+		t.Error("Account type limits are not applied")
+	}
+	if api.elementsPerWindow != 50 || api.window != time.Second {
+		t.Error("Rate limit is not applied")
+	}
+	if api.httpClient != client || api.baseURL != "http://localhost:8080" {
+		t.Error("HTTP client and base URL are not applied")
+	}
+
+	params := api.buildBaseUrlParams()
+	if params.Get("language") != "fr" || params.Get("units") != "metric" {
+		t.Error("Language and units are not applied")
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	api, err := New(WithClientIDAndSigningKey("client", "c2lnbmluZy1rZXk="), WithChannel("dispatch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if api.maxElementsPerRequest != 100 || api.elementsPerWindow != 100 {
+		t.Error("Limits should default to the free account ones")
+	}
+
+	params := api.buildBaseUrlParams()
+	if params.Get("channel") != "dispatch" {
+		t.Error("Channel is not applied")
+	}
+	if _, ok := params["units"]; ok {
+		t.Error("Units should be left for Google to pick")
+	}
+	if _, ok := api.limiter.(*tokenBucketLimiter); !ok {
+		t.Error("Rate limiter should default to a token bucket")
+	}
+}
+
+func TestNewWithSharedStore(t *testing.T) {
+	api, err := New(WithAPIKey("key"), WithAccountType(GoogleForWorkAccount), WithSharedStore(NewMemoryStore(), "dispatch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, ok := api.limiter.(*distributedLimiter)
+	if !ok {
+		t.Fatal("Rate limiter should be distributed")
+	}
+	if limiter.key != "dispatch" || limiter.elementsPerWindow != 1000 || limiter.elementsPerDay != 100000 {
+		t.Error("Distributed rate limiter does not use the account limits")
+	}
+}
+
+func TestNewInvalidConfiguration(t *testing.T) {
+	tests := []struct {
+		opts []Option
+		err  error
+	}{
+		{nil, ErrMissingCredentials},
+		{[]Option{WithAPIKey("key"), WithClientIDAndSigningKey("client", "c2lnbmluZy1rZXk=")}, ErrConflictingCredentials},
+		{[]Option{WithAPIKey("key"), WithChannel("dispatch")}, ErrChannelRequiresClientID},
+		{[]Option{WithAPIKey("key"), WithAccountType(AccountType(42))}, ErrUnknownAccountType},
+		{[]Option{WithAPIKey("key"), WithUnits(UnitSystem(42))}, ErrUnknownUnitSystem},
+		{[]Option{WithAPIKey("key"), WithRateLimit(0, time.Second)}, ErrInvalidRateLimit},
+		{[]Option{WithAPIKey("key"), WithHTTPClient(nil)}, ErrNilHTTPClient},
+		{[]Option{WithAPIKey("key"), WithRateLimiter(nil)}, ErrNilRateLimiter},
+		{[]Option{WithAPIKey("key"), WithSharedStore(nil, "key")}, ErrNilStore},
+	}
+
+	for i, test := range tests {
+		if _, err := New(test.opts...); err != test.err {
+			t.Errorf("Test %d: expected error %v, got %v", i, test.err, err)
+		}
+	}
+}
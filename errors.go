@@ -0,0 +1,172 @@
+package gogoogledm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// maxErrorBodyLength is the number of bytes of the body kept in an HTTPError.
+const maxErrorBodyLength = 512
+
+// APIError is returned when Google responds with a status other than OK.
+// It matches the sentinel error of the status with errors.Is, for instance
+// ErrRequestDenied for REQUEST_DENIED.
+type APIError struct {
+	Status string
+	// ErrorMessage is the detailed error message of Google, when provided.
+	ErrorMessage string
+	// Call is the call that failed.
+	Call ApiCall
+	err  error
+}
+
+func newAPIError(call ApiCall, apiResponse ApiResponse, err error) *APIError {
+	return &APIError{
+		Status:       apiResponse.Status,
+		ErrorMessage: apiResponse.ErrorMessage,
+		Call:         call,
+		err:          err,
+	}
+}
+
+func (e *APIError) Error() string {
+	if e.ErrorMessage != "" {
+		return fmt.Sprintf("%s: %v: %s", e.Status, e.err, e.ErrorMessage)
+	}
+	return fmt.Sprintf("%s: %v", e.Status, e.err)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
+// CallError is the error of a single call of a request. With a cache, the
+// offsets of Call are relative to the origins missing the same destinations
+// from the cache, which are requested together.
+type CallError struct {
+	Call ApiCall
+	Err  error
+	// originIndexes and destinationIndexes are the indexes in the request of
+	// the origins and destinations of the call.
+	originIndexes      []int
+	destinationIndexes []int
+}
+
+func newCallError(call ApiCall, err error) CallError {
+	callErr := CallError{
+		Call:               call,
+		Err:                err,
+		originIndexes:      make([]int, len(call.Origins)),
+		destinationIndexes: make([]int, len(call.Destinations)),
+	}
+	for i := range callErr.originIndexes {
+		callErr.originIndexes[i] = call.OriginOffset + i
+	}
+	for j := range callErr.destinationIndexes {
+		callErr.destinationIndexes[j] = call.DestinationOffset + j
+	}
+
+	return callErr
+}
+
+// PartialError is returned along with a partial response, when some of the
+// calls of a request sent with RequestOptions.Partial failed. The elements
+// of these calls are missing from the response.
+type PartialError struct {
+	Failed []CallError
+	// Calls is the total number of calls of the request.
+	Calls int
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("%d of %d calls failed, first error: %v", len(e.Failed), e.Calls, e.Failed[0].Err)
+}
+
+// Unwrap returns the errors of the failed calls, so that errors.Is matches
+// any of them.
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// HTTPError is returned when Google, or a proxy in between, responds with
+// a status other than 200, or with a body that is not valid JSON.
+type HTTPError struct {
+	StatusCode int
+	Header     http.Header
+	// Body is the beginning of the response body, truncated to 512 bytes.
+	Body string
+	// Err is the decoding error of a 200 response with an invalid body.
+	Err error
+}
+
+func newHTTPError(resp *http.Response, body []byte, err error) *HTTPError {
+	if len(body) > maxErrorBodyLength {
+		body = body[:maxErrorBodyLength]
+	}
+
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       string(body),
+		Err:        err,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid response body with http status %d: %v", e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("unexpected http status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes an HTTPError with a 5xx status match ErrServerError.
+func (e *HTTPError) Is(target error) bool {
+	return target == ErrServerError && e.StatusCode >= http.StatusInternalServerError
+}
+
+// Retryable reports whether the request may succeed if sent again, which
+// is the case of server errors, timeouts and too many requests.
+func (e *HTTPError) Retryable() bool {
+	return e.StatusCode >= http.StatusInternalServerError ||
+		e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout
+}
+
+// IsRetryable reports whether err is transient, so that the call may
+// succeed if sent again: UNKNOWN_ERROR, OVER_QUERY_LIMIT, a retryable
+// HTTPError or a transport failure, that is a timeout, a failed connection
+// or a connection closed early. Any other error is permanent, including the
+// url errors of an unsupported scheme or an invalid certificate.
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrUnkownError) || errors.Is(err, ErrOverQueryLimit) {
+		return true
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Retryable()
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
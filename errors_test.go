@@ -0,0 +1,153 @@
+package gogoogledm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPErrors(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		body       string
+		retryable  bool
+		decodeErr  bool
+	}{
+		{http.StatusBadGateway, "<html><body>" + strings.Repeat("Bad Gateway ", 100) + "</body></html>", true, false},
+		{http.StatusTooManyRequests, "Too Many Requests", true, false},
+		{http.StatusForbidden, "Forbidden", false, false},
+		{http.StatusOK, "<html><body>Proxy login</body></html>", false, true},
+	}
+
+	for i, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Proxy", "egress")
+			w.WriteHeader(test.statusCode)
+			w.Write([]byte(test.body))
+		}))
+
+		api, err := New(WithAPIKey("key"), WithBaseURL(server.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = api.GetDistancesWithOptions(context.Background(), []Location{Address("Glasgow, UK")}, []Location{Address("Manchester, UK")}, Driving, nil)
+		server.Close()
+
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Errorf("Test %d: expected an HTTPError, got %v", i, err)
+			continue
+		}
+		if httpErr.StatusCode != test.statusCode || httpErr.Header.Get("X-Proxy") != "egress" {
+			t.Errorf("Test %d: status code and headers are not as expected", i)
+		}
+		if len(httpErr.Body) > maxErrorBodyLength || !strings.HasPrefix(test.body, httpErr.Body) {
+			t.Errorf("Test %d: body is not truncated as expected", i)
+		}
+		if IsRetryable(err) != test.retryable {
+			t.Errorf("Test %d: expected retryable to be %v", i, test.retryable)
+		}
+		if (httpErr.Err != nil) != test.decodeErr {
+			t.Errorf("Test %d: decoding error is not as expected", i)
+		}
+		if errors.Is(err, ErrServerError) != (test.statusCode >= 500) {
+			t.Errorf("Test %d: only 5xx statuses should match ErrServerError", i)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(distanceMatrixHandler))
+	defer tlsServer.Close()
+	closedServer := httptest.NewServer(http.HandlerFunc(distanceMatrixHandler))
+	closedServer.Close()
+
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{ErrUnkownError, true},
+		{ErrOverQueryLimit, true},
+		{ErrRequestDenied, false},
+		{ErrInvalidRequest, false},
+		{ErrMaxDimensionsExceeded, false},
+		{ErrUnknownStatus, false},
+		{context.Canceled, false},
+		{ErrRateLimitExceedsDeadline, false},
+		// Connection refused
+		{transportError(closedServer.URL), true},
+		{transportError("htp://maps.googleapis.com"), false},
+		// Certificate signed by an unknown authority
+		{transportError(tlsServer.URL), false},
+	}
+
+	for i, test := range tests {
+		if IsRetryable(test.err) != test.retryable {
+			t.Errorf("Test %d: expected retryable to be %v for %v", i, test.retryable, test.err)
+		}
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	tests := []struct {
+		status string
+		err    error
+	}{
+		{"UNKNOWN_ERROR", ErrUnkownError},
+		{"MAX_DIMENSIONS_EXCEEDED", ErrMaxDimensionsExceeded},
+		{"SOME_NEW_STATUS", ErrUnknownStatus},
+	}
+
+	for _, test := range tests {
+		err := validateResponse(ApiCall{}, ApiResponse{Status: test.status})
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Status != test.status || !errors.Is(err, test.err) {
+			t.Errorf("Expected an APIError matching %v for %s, got %v", test.err, test.status, err)
+		}
+	}
+}
+
+// transportError returns the error of a request to url, without retries.
+func transportError(url string) error {
+	resp, err := http.Get(url)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "REQUEST_DENIED", "error_message": "This IP, site or mobile application is not authorized to use this API key."}`))
+	}))
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origins := []Location{Address("Glasgow, UK")}
+	_, err = api.GetDistancesWithOptions(context.Background(), origins, []Location{Address("Manchester, UK")}, Driving, nil)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an APIError, got %v", err)
+	}
+	if apiErr.Status != "REQUEST_DENIED" || apiErr.ErrorMessage != "This IP, site or mobile application is not authorized to use this API key." {
+		t.Error("Status and error message are not as expected")
+	}
+	if len(apiErr.Call.Origins) != 1 || apiErr.Call.Origins[0] != origins[0] {
+		t.Error("Failed call is not as expected")
+	}
+	if !errors.Is(err, ErrRequestDenied) || errors.Is(err, ErrInvalidRequest) {
+		t.Error("APIError should only match the sentinel error of its status")
+	}
+	if !strings.Contains(err.Error(), "not authorized") {
+		t.Error("Error message should include Google's error message")
+	}
+}
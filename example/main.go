@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"golang.org/x/net/context"
@@ -10,11 +11,20 @@ import (
 )
 
 func main() {
-	apiKey := ""               //obtain your key from Google Developers Console
-	accountType := FreeAccount //FreeAccount or GoogleForWorkAccount
-	languageCode := "en-GB"    //codes available here https://developers.google.com/maps/faq#languagesupport
-	unitSystem := ImperialUnit //ImperialUnit or MetricUnit
-	api := NewDistanceMatrixAPI(apiKey, accountType, languageCode, unitSystem)
+	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY") //obtain your key from Google Developers Console
+	accountType := FreeAccount                 //FreeAccount or GoogleForWorkAccount
+	languageCode := "en-GB"                    //codes available here https://developers.google.com/maps/faq#languagesupport
+	unitSystem := ImperialUnit                 //ImperialUnit or MetricUnit
+	api, err := New(
+		WithAPIKey(apiKey),
+		WithAccountType(accountType),
+		WithLanguage(languageCode),
+		WithUnits(unitSystem),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	origins := []Coordinates{
 		Coordinates{
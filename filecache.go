@@ -0,0 +1,255 @@
+package gogoogledm
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileCache is a Cache persisted in a file, which survives restarts and can
+// be shared by the processes of a machine.
+//
+// The file is a log of JSON lines, one per element set, appended by every
+// process. When it misses a key, a process reloads the lines appended by the
+// others, and reopens the file if another process replaced it by compacting
+// it, at most once per second. Elements appended by a process while another
+// one compacts the file may be lost, which only costs requesting them again.
+type FileCache struct {
+	path string
+	// refreshInterval is the minimum time between two checks of the file
+	// for changes made by other processes.
+	refreshInterval time.Duration
+
+	mu      sync.Mutex
+	file    *os.File
+	info    os.FileInfo
+	entries map[string]fileCacheRecord
+	// offset is the length of the file already loaded, and records the
+	// number of lines in it.
+	offset      int64
+	records     int
+	lastRefresh time.Time
+}
+
+const fileCacheRefreshInterval = time.Second
+
+type fileCacheRecord struct {
+	Key     string        `json:"key"`
+	Element CachedElement `json:"element"`
+	// ExpiresAt is in nanoseconds since the epoch, 0 for no expiration.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+func (r fileCacheRecord) expired(now time.Time) bool {
+	return r.ExpiresAt != 0 && now.UnixNano() > r.ExpiresAt
+}
+
+// NewFileCache opens the cache stored in the file at path, creating it if
+// needed. The file is compacted when more than half of its lines are
+// overwritten or expired elements.
+func NewFileCache(path string) (*FileCache, error) {
+	c := &FileCache{path: path, refreshInterval: fileCacheRefreshInterval}
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+
+	if c.records > 2*len(c.entries) {
+		if err := c.compact(); err != nil {
+			c.file.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *FileCache) Get(key string) (CachedElement, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record, ok := c.entries[key]
+	if !ok {
+		// Another process may have set it since the last refresh
+		if err := c.refresh(false); err != nil {
+			return CachedElement{}, false
+		}
+		record, ok = c.entries[key]
+	}
+	if !ok {
+		return CachedElement{}, false
+	}
+	if record.expired(time.Now()) {
+		delete(c.entries, key)
+		return CachedElement{}, false
+	}
+
+	return record.Element, true
+}
+
+// Set stores element in memory and appends it to the file. If the file
+// cannot be written, element is only cached by this process.
+func (c *FileCache) Set(key string, element CachedElement, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record := fileCacheRecord{Key: key, Element: element}
+	if ttl > 0 {
+		record.ExpiresAt = time.Now().Add(ttl).UnixNano()
+	}
+	// Refreshing first, since reopening the file replaces the entries
+	err := c.refresh(false)
+	c.entries[key] = record
+	if err != nil {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	// The line is written at once, so that the lines appended by several
+	// processes do not interleave.
+	c.file.Write(append(line, '\n'))
+}
+
+// Compact rewrites the file with only the elements that are not expired.
+func (c *FileCache) Compact() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.refresh(true); err != nil {
+		return err
+	}
+	return c.compact()
+}
+
+// Close closes the file. The cache must not be used afterwards.
+func (c *FileCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.file.Close()
+}
+
+// open opens the file at path and loads it from the beginning.
+func (c *FileCache) open() error {
+	file, err := os.OpenFile(c.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	c.file = file
+	c.info = info
+	c.entries = make(map[string]fileCacheRecord)
+	c.offset = 0
+	c.records = 0
+	c.lastRefresh = time.Now()
+	return c.load()
+}
+
+// refresh reopens the file if another process replaced it, or loads the
+// lines appended to it since the last load. Unless forced, the file is
+// checked at most once per refresh interval.
+func (c *FileCache) refresh(force bool) error {
+	now := time.Now()
+	if !force && now.Sub(c.lastRefresh) < c.refreshInterval {
+		return nil
+	}
+	c.lastRefresh = now
+
+	info, err := os.Stat(c.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if info == nil || !os.SameFile(info, c.info) {
+		c.file.Close()
+		return c.open()
+	}
+	if info.Size() == c.offset {
+		return nil
+	}
+	return c.load()
+}
+
+// load reads the complete lines of the file after offset. The last line may
+// be incomplete while another process writes it, it is then read by the
+// next load.
+func (c *FileCache) load() error {
+	reader := bufio.NewReader(io.NewSectionReader(c.file, c.offset, math.MaxInt64-c.offset))
+	now := time.Now()
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c.offset += int64(len(line))
+		c.records++
+
+		var record fileCacheRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			// A corrupted line only loses its element
+			continue
+		}
+		if record.expired(now) {
+			// The last line of a key wins, even expired
+			delete(c.entries, record.Key)
+			continue
+		}
+		c.entries[record.Key] = record
+	}
+}
+
+// compact writes the elements that are not expired to a temporary file,
+// which then replaces the file.
+func (c *FileCache) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// The temporary file is only readable by its owner, unlike the file
+	if err := tmp.Chmod(c.info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	now := time.Now()
+	for _, record := range c.entries {
+		if record.expired(now) {
+			continue
+		}
+		if err := encoder.Encode(record); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+
+	c.file.Close()
+	return c.open()
+}
@@ -0,0 +1,197 @@
+package gogoogledm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testCachedElement(text string) CachedElement {
+	var element ApiElement
+	element.Distance.Text = text
+	element.Distance.Value = 1000
+	element.Status = "OK"
+	return CachedElement{OriginAddress: "origin", DestinationAddress: "destination", Element: element}
+}
+
+func countLines(t *testing.T, path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestFileCacheSurvivesRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	cache, err := NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Set("a", testCachedElement("a"), 0)
+	cache.Set("b", testCachedElement("b"), time.Millisecond)
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	cache, err = NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	if e, ok := cache.Get("a"); !ok || e != testCachedElement("a") {
+		t.Errorf("a should have been reloaded, got %v", e)
+	}
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b should have expired")
+	}
+}
+
+func TestFileCacheIsShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	first, err := NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	first.refreshInterval = 0
+	second.refreshInterval = 0
+
+	first.Set("a", testCachedElement("a"), 0)
+	if _, ok := second.Get("a"); !ok {
+		t.Error("a should have been loaded from the file")
+	}
+
+	// An incomplete line is read once complete
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.WriteString(`{"key": "c", "element": {"element": {"status": `)
+	if _, ok := second.Get("c"); ok {
+		t.Error("c should not be loaded while incomplete")
+	}
+	file.WriteString(`"OK"}}}` + "\n")
+	if e, ok := second.Get("c"); !ok || e.Element.Status != "OK" {
+		t.Error("c should have been loaded once complete")
+	}
+
+	// The second cache reopens the file compacted by the first one
+	if err := first.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	second.Set("b", testCachedElement("b"), 0)
+	if _, ok := first.Get("b"); !ok {
+		t.Error("b should have been appended to the compacted file")
+	}
+	second.refreshInterval = time.Hour
+	if _, ok := second.Get("b"); !ok {
+		t.Error("b should have been kept in memory when reopening the file")
+	}
+}
+
+func TestFileCacheCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	cache, err := NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		cache.Set("a", testCachedElement("a"), 0)
+	}
+	cache.Set("b", testCachedElement("b"), 0)
+	cache.Close()
+
+	if countLines(t, path) != 11 {
+		t.Fatalf("Expected 11 lines, got %d", countLines(t, path))
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the cache compacts the overwritten elements
+	cache, err = NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	if countLines(t, path) != 2 {
+		t.Errorf("Expected 2 lines once compacted, got %d", countLines(t, path))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Compaction should keep the mode of the file, got %v", info.Mode().Perm())
+	}
+	if _, ok := cache.Get("a"); !ok {
+		t.Error("a should have been kept")
+	}
+	if _, ok := cache.Get("b"); !ok {
+		t.Error("b should have been kept")
+	}
+}
+
+func TestFileCacheRefreshInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	first, err := NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.refreshInterval = time.Hour
+
+	first.Set("a", testCachedElement("a"), 0)
+	if _, ok := second.Get("a"); ok {
+		t.Error("a should not be loaded before the refresh interval")
+	}
+
+	second.lastRefresh = time.Now().Add(-time.Hour)
+	if _, ok := second.Get("a"); !ok {
+		t.Error("a should have been loaded after the refresh interval")
+	}
+}
+
+func TestFileCacheCompactsExpiredElements(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	cache, err := NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set(key, testCachedElement(key), time.Millisecond)
+	}
+	cache.Set("d", testCachedElement("d"), 0)
+	cache.Close()
+
+	time.Sleep(5 * time.Millisecond)
+	cache, err = NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	if len(cache.entries) != 1 {
+		t.Errorf("Expired elements should not be loaded, got %d entries", len(cache.entries))
+	}
+	if countLines(t, path) != 1 {
+		t.Errorf("Expected 1 line once compacted, got %d", countLines(t, path))
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,6 +19,9 @@ const (
 	base_host    = "https://maps.googleapis.com"
 	base_path    = "/maps/api/distancematrix/json?"
 	maxUrlLength = 2000
+	// Google rejects more than 25 origins or 25 destinations in a request,
+	// whatever the number of elements.
+	maxLocationsPerRequest = 25
 )
 
 var (
@@ -24,8 +30,16 @@ var (
 	ErrOverQueryLimit         = errors.New("too many requests from your application within the allowed time period")
 	ErrRequestDenied          = errors.New("service denied use of the distance matrix service by your application")
 	ErrUnkownError            = errors.New("distance matrix request could not be processed due to a server error")
+	ErrMaxDimensionsExceeded  = errors.New("number of origins or destinations exceeds the per-query limit")
 	ErrResponseRowsMismatch   = errors.New("invalid response: less rows than origins requested")
 	ErrInvalidElementMismatch = errors.New("invalid response: less elements than destinations requested")
+	// ErrUnknownStatus is returned for a status this package does not know,
+	// which is not retried.
+	ErrUnknownStatus = errors.New("distance matrix responded with an unknown status")
+	// ErrServerError matches an HTTPError with a 5xx status with errors.Is.
+	ErrServerError = errors.New("server responded with an http 5xx status")
+	// ErrRateLimitExceedsDeadline matches context.DeadlineExceeded with errors.Is.
+	ErrRateLimitExceedsDeadline = fmt.Errorf("waiting for the rate limit would exceed the context deadline: %w", context.DeadlineExceeded)
 )
 
 // Distance Matrix API URLs are restricted to approximately 2000 characters, after URL Encoding.
@@ -35,6 +49,7 @@ var (
 // OK indicates the response contains a valid result.
 // INVALID_REQUEST indicates that the provided request was invalid.
 // MAX_ELEMENTS_EXCEEDED indicates that the product of origins and destinations exceeds the per-query limit.
+// MAX_DIMENSIONS_EXCEEDED indicates that the number of origins or destinations exceeds the per-query limit.
 // OVER_QUERY_LIMIT indicates the service has received too many requests from your application within the allowed time period.
 // REQUEST_DENIED indicates that the service denied use of the Distance Matrix service by your application.
 // UNKNOWN_ERROR indicates a Distance Matrix request could not be processed due to a server error. The request may succeed if you try again.
@@ -44,19 +59,24 @@ var (
 // OK indicates the response contains a valid result.
 // NOT_FOUND indicates that the origin and/or destination of this pairing could not be geocoded.
 // ZERO_RESULTS indicates no route could be found between the origin and destination.
+// MAX_ROUTE_LENGTH_EXCEEDED indicates the requested route is too long and cannot be processed.
+// See ElementStatus and Element.Err.
 
+// Deprecated: use New with WithAPIKey.
 func NewDistanceMatrixAPI(apiKey string, accountType AccountType, languageCode string, unitSystem UnitSystem) *DistanceMatrixAPI {
-	api := DistanceMatrixAPI{
-		apiKey:       apiKey,
-		languageCode: languageCode,
-		unitSystem:   unitSystem,
-		timeToWait:   10 * time.Second,
+	api := newDistanceMatrixAPI()
+	api.apiKey = apiKey
+	api.languageCode = languageCode
+	api.unitSystem = unitSystem
+	if err := api.setAccountType(accountType); err != nil {
+		panic(err)
 	}
-	api.maxElementsPerRequest = maxElementsPerRequestFromAccountType(accountType)
+	api.limiter = api.defaultRateLimiter()
 
-	return &api
+	return api
 }
 
+// Deprecated: use New with WithClientIDAndSigningKey.
 func NewDistanceMatrixAPIWithClientIDAndSignature(clientID, codedCryptoKey string, accountType AccountType, languageCode string, unitSystem UnitSystem) (*DistanceMatrixAPI, error) {
 	// The coded crypt key is assumed to be URL modified Base64 encoded
 	decodedCryptoKey, err := base64.URLEncoding.DecodeString(codedCryptoKey)
@@ -64,19 +84,42 @@ func NewDistanceMatrixAPIWithClientIDAndSignature(clientID, codedCryptoKey strin
 		return nil, err
 	}
 
-	api := DistanceMatrixAPI{
-		clientID:     clientID,
-		cryptoKey:    decodedCryptoKey,
-		languageCode: languageCode,
-		unitSystem:   unitSystem,
-		timeToWait:   10 * time.Second,
+	api := newDistanceMatrixAPI()
+	api.clientID = clientID
+	api.cryptoKey = decodedCryptoKey
+	api.languageCode = languageCode
+	api.unitSystem = unitSystem
+	if err := api.setAccountType(accountType); err != nil {
+		panic(err)
 	}
-	api.maxElementsPerRequest = maxElementsPerRequestFromAccountType(accountType)
+	api.limiter = api.defaultRateLimiter()
 
-	return &api, nil
+	return api, nil
 }
 
-func maxElementsPerRequestFromAccountType(accountType AccountType) int {
+func newDistanceMatrixAPI() *DistanceMatrixAPI {
+	return &DistanceMatrixAPI{
+		window:      10 * time.Second,
+		httpClient:  http.DefaultClient,
+		baseURL:     base_host,
+		retryPolicy: noRetryPolicy,
+		concurrency: 1,
+	}
+}
+
+// SetHTTPClient sets the client used to send the requests, which defaults to http.DefaultClient.
+func (api *DistanceMatrixAPI) SetHTTPClient(client *http.Client) {
+	api.httpClient = client
+}
+
+// SetBaseURL sets the scheme and host the requests are sent to, which
+// defaults to https://maps.googleapis.com. It allows to go through a proxy
+// or to use a test server.
+func (api *DistanceMatrixAPI) SetBaseURL(baseURL string) {
+	api.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+func (api *DistanceMatrixAPI) setAccountType(accountType AccountType) error {
 	// Users of the free API:
 	// 100 elements per query.
 	// 100 elements per 10 seconds.
@@ -86,58 +129,232 @@ func maxElementsPerRequestFromAccountType(accountType AccountType) int {
 	// 625 elements per query.
 	// 1,000 elements per 10 seconds.
 	// 100,000 elements per 24 hour period.
+	var elementsPerWindow int
 	switch accountType {
 	case FreeAccount:
-		return 100
+		api.maxElementsPerRequest = 100
+		elementsPerWindow = 100
+		api.elementsPerDay = 2500
 	case GoogleForWorkAccount:
-		return 625
+		api.maxElementsPerRequest = 625
+		elementsPerWindow = 1000
+		api.elementsPerDay = 100000
 	default:
-		panic("Unknown accountType")
+		return ErrUnknownAccountType
+	}
+
+	// Keep a rate limit set with WithRateLimit
+	if api.elementsPerWindow == 0 {
+		api.elementsPerWindow = elementsPerWindow
 	}
+
+	return nil
+}
+
+func (api *DistanceMatrixAPI) defaultRateLimiter() RateLimiter {
+	if api.store != nil {
+		return NewDistributedRateLimiter(api.store, api.storeKey, api.elementsPerWindow, api.window, api.elementsPerDay)
+	}
+	return NewRateLimiter(api.elementsPerWindow, api.window, api.elementsPerDay)
 }
 
 func (api *DistanceMatrixAPI) buildBaseUrlParams() url.Values {
 	params := url.Values{}
-	params.Add("language", api.languageCode)
-	params.Add("units", api.unitSystem.String())
+	if api.languageCode != "" {
+		params.Add("language", api.languageCode)
+	}
+	if api.unitSystem != 0 {
+		params.Add("units", api.unitSystem.String())
+	}
+	if api.channel != "" {
+		params.Add("channel", api.channel)
+	}
+
+	return params
+}
+
+func (api *DistanceMatrixAPI) buildUrlParams(transportMode TransportMode, opts *RequestOptions) url.Values {
+	params := api.buildBaseUrlParams()
+	params.Add("mode", transportMode.String())
+	opts.addUrlParams(params)
 
 	return params
 }
 
 func (api *DistanceMatrixAPI) GetDistances(ctx context.Context, origins []Coordinates, destinations []Coordinates, transportMode TransportMode) (*ApiResponse, error) {
-	apiRequestCount := api.numberOfApiCallsRequired(origins, destinations, transportMode)
-	groupedCoordinates := api.groupCoordinates(origins, destinations, apiRequestCount)
-
-	var joinedResponse ApiResponse
-	remaining := api.maxElementsPerRequest
-	for _, group := range groupedCoordinates {
-		need := (len(group.Origins) * len(group.Destinations))
-		if remaining < need {
-			time.Sleep(api.timeToWait)
-			remaining = api.maxElementsPerRequest
+	return api.GetDistancesWithOptions(ctx, LocationsFromCoordinates(origins), LocationsFromCoordinates(destinations), transportMode, nil)
+}
+
+// GetDistancesWithOptions is like GetDistances but accepts any kind of
+// location, which can be mixed in a single request, and also sends the
+// optional parameters set in opts, which may be nil. With a cache, only the
+// pairs missing from the cache are requested.
+func (api *DistanceMatrixAPI) GetDistancesWithOptions(ctx context.Context, origins []Location, destinations []Location, transportMode TransportMode, opts *RequestOptions) (*ApiResponse, error) {
+	origins = quantizeLocations(api.requestQuantizer, origins)
+	destinations = quantizeLocations(api.requestQuantizer, destinations)
+
+	if api.cacheable(opts) {
+		return api.getCachedDistances(ctx, origins, destinations, transportMode, opts)
+	}
+
+	plan, err := api.planRequest(origins, destinations, transportMode, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.execute(ctx, plan, len(origins), len(destinations), transportMode, opts)
+}
+
+// execute sends the calls of plan and joins their responses into a
+// originsSize x destinationsSize response.
+func (api *DistanceMatrixAPI) execute(ctx context.Context, plan *QueryPlan, originsSize int, destinationsSize int, transportMode TransportMode, opts *RequestOptions) (*ApiResponse, error) {
+	responses, callErrs, err := api.send(ctx, plan, transportMode, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	joinedResponse := newApiResponse(originsSize, destinationsSize)
+	var partialErr PartialError
+	for i, call := range plan.Calls {
+		if callErrs[i] != nil {
+			partialErr.Failed = append(partialErr.Failed, newCallError(call.ApiCall, callErrs[i]))
+			continue
 		}
+		joinedResponse.merge(call.ApiCall, responses[i])
+	}
+
+	if len(partialErr.Failed) > 0 {
+		partialErr.Calls = len(plan.Calls)
+		return joinedResponse, &partialErr
+	}
+	return joinedResponse, nil
+}
 
-		resp, err := api.sendRequest(ctx, group.Origins, group.Destinations, transportMode)
-		if err != nil {
-			return nil, err
+// send sends the calls of plan, unless waiting for the rate limit would
+// exceed the deadline of ctx. See dispatch for the values returned.
+func (api *DistanceMatrixAPI) send(ctx context.Context, plan *QueryPlan, transportMode TransportMode, opts *RequestOptions) ([]*ApiResponse, []error, error) {
+	// Fail fast rather than waiting for the rate limit until the deadline
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < plan.ExpectedWait {
+		return nil, nil, ErrRateLimitExceedsDeadline
+	}
+
+	if plan.ExpectedWait > 0 {
+		api.logf("%d calls, expecting to wait %s for the rate limit", len(plan.Calls), plan.ExpectedWait)
+	}
+
+	return api.dispatch(ctx, plan.Calls, transportMode, opts)
+}
+
+// dispatch sends the calls, up to the concurrency of the api at a time, and
+// returns their responses in the order of calls. It stops at the first error,
+// unless the request is partial, in which case every call is sent and the
+// error of each failed call is returned at its index in callErrs.
+func (api *DistanceMatrixAPI) dispatch(ctx context.Context, calls []PlannedCall, transportMode TransportMode, opts *RequestOptions) (responses []*ApiResponse, callErrs []error, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responses = make([]*ApiResponse, len(calls))
+	callErrs = make([]error, len(calls))
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	pending := make(chan int)
+	for i := 0; i < minInt(api.concurrency, len(calls)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pending {
+				call := calls[i]
+				resp, err := api.sendCall(ctx, call, transportMode, opts)
+
+				mu.Lock()
+				if err != nil && opts.partial() {
+					api.logf("call at %d,%d failed: %v", call.OriginOffset, call.DestinationOffset, err)
+					callErrs[i] = err
+				} else if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else {
+					responses[i] = resp
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// Calls are handed out in the order of the plan, so that they queue up
+	// in that order in the rate limiter. The calls of a partial request are
+	// all handed out, those left when the context is done fail right away.
+	done := ctx.Done()
+	if opts.partial() {
+		done = nil
+	}
+	var interrupted bool
+send:
+	for i := range calls {
+		select {
+		case pending <- i:
+		case <-done:
+			interrupted = true
+			break send
 		}
+	}
+	close(pending)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	if interrupted {
+		// The context was done before any call failed
+		return nil, nil, ctx.Err()
+	}
+	return responses, callErrs, nil
+}
+
+// newApiResponse returns a response with the rows and elements of a full
+// origins x destinations matrix allocated.
+func newApiResponse(originsSize int, destinationsSize int) *ApiResponse {
+	apiResponse := ApiResponse{
+		OriginAddresses:      make([]string, originsSize),
+		DestinationAddresses: make([]string, destinationsSize),
+		Rows:                 make([]ApiRow, originsSize),
+	}
+	for i := range apiResponse.Rows {
+		apiResponse.Rows[i].Elements = make([]ApiElement, destinationsSize)
+	}
+
+	return &apiResponse
+}
 
-		joinedResponse.Status = resp.Status
-		joinedResponse.OriginAddresses = append(joinedResponse.OriginAddresses, resp.OriginAddresses...)
-		joinedResponse.DestinationAddresses = append(joinedResponse.DestinationAddresses, resp.DestinationAddresses...)
-		joinedResponse.Rows = append(joinedResponse.Rows, resp.Rows...)
+// merge copies the response of a single call at its place in the full matrix.
+func (apiResponse *ApiResponse) merge(call ApiCall, resp *ApiResponse) {
+	apiResponse.Status = resp.Status
 
-		remaining -= need
+	for i, r := range resp.Rows {
+		copy(apiResponse.Rows[call.OriginOffset+i].Elements[call.DestinationOffset:], r.Elements)
 	}
 
-	return &joinedResponse, nil
+	// Each address is returned by every call sharing its origin or destination,
+	// only the calls on the first row and column are kept so that the result
+	// does not depend on the order of the calls.
+	if call.DestinationOffset == 0 {
+		copy(apiResponse.OriginAddresses[call.OriginOffset:], resp.OriginAddresses)
+	}
+	if call.OriginOffset == 0 {
+		copy(apiResponse.DestinationAddresses[call.DestinationOffset:], resp.DestinationAddresses)
+	}
 }
 
 // Code taken from the generateAuthQuery function from google-maps-services-go
 func (api *DistanceMatrixAPI) generateAuthentifiedURL(urlValues url.Values) (string, error) {
 	if api.apiKey != "" {
 		urlValues.Add("key", api.apiKey)
-		return (base_host + base_path + urlValues.Encode()), nil
+		return (api.baseURL + base_path + urlValues.Encode()), nil
 	}
 
 	signedQuery, err := signURL(base_path, api.clientID, api.cryptoKey, urlValues)
@@ -145,14 +362,13 @@ func (api *DistanceMatrixAPI) generateAuthentifiedURL(urlValues url.Values) (str
 		return "", err
 	}
 
-	return (base_host + base_path + signedQuery), nil
+	return (api.baseURL + base_path + signedQuery), nil
 }
 
-func (api *DistanceMatrixAPI) sendRequest(ctx context.Context, origins []Coordinates, destinations []Coordinates, transportMode TransportMode) (*ApiResponse, error) {
-	urlValues := api.buildBaseUrlParams()
-	urlValues.Add("mode", transportMode.String())
-	urlValues.Add("origins", coordinatesSliceToString(origins))
-	urlValues.Add("destinations", coordinatesSliceToString(destinations))
+func (api *DistanceMatrixAPI) sendRequest(ctx context.Context, call ApiCall, transportMode TransportMode, opts *RequestOptions) (*ApiResponse, error) {
+	urlValues := api.buildUrlParams(transportMode, opts)
+	urlValues.Add("origins", locationsSliceToString(call.Origins, opts.polylineEncoding()))
+	urlValues.Add("destinations", locationsSliceToString(call.Destinations, opts.polylineEncoding()))
 
 	url, err := api.generateAuthentifiedURL(urlValues)
 	if err != nil {
@@ -165,108 +381,68 @@ func (api *DistanceMatrixAPI) sendRequest(ctx context.Context, origins []Coordin
 	}
 	req = req.WithContext(ctx)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := api.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
 
-	var apiResponse ApiResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
 		return nil, err
 	}
 
-	if err = validateResponse(origins, destinations, apiResponse); err != nil {
-		return nil, err
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHTTPError(resp, body, nil)
 	}
 
-	return &apiResponse, nil
-}
-
-func (api *DistanceMatrixAPI) groupCoordinates(origins []Coordinates, destinations []Coordinates, maxGroupSize int) (apiCalls []ApiCall) {
-	if maxGroupSize == 1 {
-		apiCalls = append(apiCalls, ApiCall{origins, destinations})
-		return apiCalls
+	var apiResponse ApiResponse
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, newHTTPError(resp, body, err)
 	}
 
-	destinationsSize := len(destinations)
-	originsSize := len(origins)
-
-	if destinationsSize > originsSize {
-		//Split destinations
-		maxBlockSize := math.Floor(float64(destinationsSize) / float64(maxGroupSize))
-		blocks := splitSliceIntoBlocks(destinations, int(maxBlockSize))
-
-		for _, b := range blocks {
-			apiCalls = append(apiCalls, ApiCall{
-				Origins:      origins,
-				Destinations: b,
-			})
-		}
-	} else {
-		//Split origins
-		maxBlockSize := math.Floor(float64(originsSize) / float64(maxGroupSize))
-		blocks := splitSliceIntoBlocks(origins, int(maxBlockSize))
-
-		for _, o := range blocks {
-			apiCalls = append(apiCalls, ApiCall{
-				Origins:      o,
-				Destinations: destinations,
-			})
-		}
+	if err = validateResponse(call, apiResponse); err != nil {
+		return nil, err
 	}
 
-	return apiCalls
-}
-
-func (api *DistanceMatrixAPI) numberOfApiCallsRequired(origins []Coordinates, destinations []Coordinates, transportMode TransportMode) int {
-	urlValues := api.buildBaseUrlParams()
-	urlValues.Add("mode", transportMode.String())
-
-	//Number of calls required by origin/destination combination
-	elementCount := float64(len(origins) * len(destinations))
-	apiCallsRequired := math.Ceil(elementCount / float64(api.maxElementsPerRequest))
-
-	//Number of calls required due to url length limitation
-	urlValues.Add("origins", coordinatesSliceToString(origins))
-	urlValues.Add("destinations", coordinatesSliceToString(destinations))
-	url := base_host + base_path + urlValues.Encode()
-	urlLength := len(url)
-	apiCallsRequiredByUrl := math.Ceil(float64(urlLength) / float64(maxUrlLength))
-
-	return int(math.Max(apiCallsRequired, apiCallsRequiredByUrl))
+	return &apiResponse, nil
 }
 
-func validateResponse(origins []Coordinates, destinations []Coordinates, apiResponse ApiResponse) error {
+func validateResponse(call ApiCall, apiResponse ApiResponse) error {
 	switch apiResponse.Status {
 	case "OK":
 		// indicates the response contains a valid result.
 		// This is not an error. We do not return on purpose here.
 	case "INVALID_REQUEST":
 		// indicates that the provided request was invalid.
-		return ErrInvalidRequest
+		return newAPIError(call, apiResponse, ErrInvalidRequest)
 	case "MAX_ELEMENTS_EXCEEDED":
 		// indicates that the product of origins and destinations exceeds the per-query limit.
-		return ErrMaxElementsExceeded
+		return newAPIError(call, apiResponse, ErrMaxElementsExceeded)
 	case "OVER_QUERY_LIMIT":
 		// indicates the service has received too many requests from your application within the allowed time period.
-		return ErrOverQueryLimit
+		return newAPIError(call, apiResponse, ErrOverQueryLimit)
 	case "REQUEST_DENIED":
 		// indicates that the service denied use of the distance matrix service by your application.
-		return ErrRequestDenied
-	default:
-		// any other error such as UNKNOWN_ERROR indicates a distance matrix request could not be processed due to a server error.
+		return newAPIError(call, apiResponse, ErrRequestDenied)
+	case "MAX_DIMENSIONS_EXCEEDED":
+		// indicates that the number of origins or destinations exceeds the per-query limit.
+		return newAPIError(call, apiResponse, ErrMaxDimensionsExceeded)
+	case "UNKNOWN_ERROR":
+		// indicates a distance matrix request could not be processed due to a server error.
 		// The request may succeed if you try again.
-		return ErrUnkownError
+		return newAPIError(call, apiResponse, ErrUnkownError)
+	default:
+		return newAPIError(call, apiResponse, ErrUnknownStatus)
 	}
 
-	if len(apiResponse.Rows) != len(origins) {
+	if len(apiResponse.Rows) != len(call.Origins) {
 		return ErrResponseRowsMismatch
 	}
 
 	for _, r := range apiResponse.Rows {
-		if len(r.Elements) != len(destinations) {
+		if len(r.Elements) != len(call.Destinations) {
 			return ErrInvalidElementMismatch
 		}
 	}
@@ -274,20 +450,39 @@ func validateResponse(origins []Coordinates, destinations []Coordinates, apiResp
 	return nil
 }
 
-func coordinatesSliceToString(coordinates []Coordinates) (result string) {
-	seperator := "|"
-	for _, c := range coordinates {
-		result += c.String() + seperator
+func locationsSliceToString(locations []Location, polylineEncoding bool) string {
+	if polylineEncoding {
+		if coordinates, ok := locationsToCoordinates(locations); ok {
+			return "enc:" + EncodePolyline(coordinates) + ":"
+		}
+	}
+
+	values := make([]string, len(locations))
+	for i, l := range locations {
+		values[i] = l.String()
+	}
+
+	return strings.Join(values, "|")
+}
+
+// locationsToCoordinates returns the coordinates of locations, if they are all coordinates.
+func locationsToCoordinates(locations []Location) ([]Coordinates, bool) {
+	coordinates := make([]Coordinates, len(locations))
+	for i, l := range locations {
+		c, ok := l.(Coordinates)
+		if !ok {
+			return nil, false
+		}
+		coordinates[i] = c
 	}
-	result = strings.TrimSuffix(result, seperator)
 
-	return result
+	return coordinates, true
 }
 
-func splitSliceIntoBlocks(slice []Coordinates, maxBlockSize int) [][]Coordinates {
+func splitSliceIntoBlocks(slice []Location, maxBlockSize int) [][]Location {
 	sliceSize := len(slice)
 	numberOfBlocks := int(math.Ceil(float64(sliceSize) / float64(maxBlockSize)))
-	blocks := make([][]Coordinates, numberOfBlocks)
+	blocks := make([][]Location, numberOfBlocks)
 
 	i := 0
 	for remaining := sliceSize; remaining > 0; remaining -= maxBlockSize {
@@ -295,7 +490,7 @@ func splitSliceIntoBlocks(slice []Coordinates, maxBlockSize int) [][]Coordinates
 		if remaining < maxBlockSize {
 			maxBlockSize = remaining
 		}
-		blocks[i] = make([]Coordinates, maxBlockSize)
+		blocks[i] = make([]Location, maxBlockSize)
 		blocks[i] = slice[start : start+maxBlockSize]
 		i++
 	}
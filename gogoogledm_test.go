@@ -2,8 +2,15 @@ package gogoogledm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -93,9 +100,15 @@ func TestGetDistancesWithTimeout(t *testing.T) {
 }
 
 func TestGetDistancesWithOver100Elements(t *testing.T) {
-	apiKey := ""
-	api := NewDistanceMatrixAPI(apiKey, FreeAccount, "en-GB", ImperialUnit)
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	server := httptest.NewServer(http.HandlerFunc(distanceMatrixHandler))
+	defer server.Close()
+
+	// 206 elements wait about 200ms for the rate limit, within the deadline
+	api, err := New(WithAPIKey("key"), WithAccountType(FreeAccount), WithBaseURL(server.URL), WithRateLimit(100, 200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
 	origins := []Coordinates{
@@ -133,7 +146,7 @@ func TestGetDistancesWithOver100Elements(t *testing.T) {
 	}
 }
 
-func TestCoordinatesSliceToString(t *testing.T) {
+func TestLocationsSliceToString(t *testing.T) {
 	coordinates := []Coordinates{
 		Coordinates{
 			Latitude:  53.4720286,
@@ -145,10 +158,44 @@ func TestCoordinatesSliceToString(t *testing.T) {
 		},
 	}
 
-	result := coordinatesSliceToString(coordinates)
+	result := locationsSliceToString(LocationsFromCoordinates(coordinates), false)
 	if result != "53.4720286,-2.3308237|51.556021,-0.279519" {
 		t.Error("Coordinates didnt match expected string")
 	}
+
+	locations := []Location{
+		Coordinates{
+			Latitude:  53.4720286,
+			Longitude: -2.3308237,
+		},
+		Address("Manchester Airport, UK"),
+		PlaceID("ChIJ2eUgeAK6j4ARbn5u_wAGqWA"),
+		PlusCode("9C5VFX37+GC"),
+	}
+
+	result = locationsSliceToString(locations, false)
+	if result != "53.4720286,-2.3308237|Manchester Airport, UK|place_id:ChIJ2eUgeAK6j4ARbn5u_wAGqWA|9C5VFX37+GC" {
+		t.Error("Mixed locations didnt match expected string")
+	}
+
+	result = locationsSliceToString(LocationsFromCoordinates(coordinates), true)
+	if result != "enc:ewjeIrffM`fuJssoK:" {
+		t.Error("Coordinates didnt match expected polyline")
+	}
+
+	result = locationsSliceToString(locations, true)
+	if !strings.HasPrefix(result, "53.4720286,-2.3308237|") {
+		t.Error("Mixed locations should not be encoded as a polyline")
+	}
+}
+
+func numberOfApiCalls(t *testing.T, api *DistanceMatrixAPI, origins []Location, destinations []Location, transportMode TransportMode, opts *RequestOptions) int {
+	apiCalls, err := api.planCalls(origins, destinations, transportMode, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(apiCalls)
 }
 
 func TestNumberOfApiCallsRequired(t *testing.T) {
@@ -171,9 +218,10 @@ func TestNumberOfApiCallsRequired(t *testing.T) {
 		destinations = append(destinations, destination)
 	}
 
-	count := api.numberOfApiCallsRequired(origins, destinations, Driving)
+	// At most 25 destinations per call
+	count := numberOfApiCalls(t, api, LocationsFromCoordinates(origins), LocationsFromCoordinates(destinations), Driving, nil)
 	log.Println(count)
-	if count != 2 {
+	if count != 5 {
 		t.Error("Number of API requests does not equal expected value")
 	}
 
@@ -193,15 +241,16 @@ func TestNumberOfApiCallsRequired(t *testing.T) {
 		destinations = append(destinations, destination)
 	}
 
-	count = api.numberOfApiCallsRequired(origins, destinations, Driving)
+	// 100 elements would fit in a single call, but not 100 destinations
+	count = numberOfApiCalls(t, api, LocationsFromCoordinates(origins), LocationsFromCoordinates(destinations), Driving, nil)
 	log.Println(count)
-	if count != 2 {
+	if count != 4 {
 		t.Error("Number of API requests does not equal expected value")
 	}
 }
 
 func TestSplitSliceIntoBlocks(t *testing.T) {
-	var coordinates []Coordinates
+	var coordinates []Location
 	for i := 0; i < 3; i++ {
 		c := Coordinates{
 			Latitude:  float64(i),
@@ -255,3 +304,390 @@ func TestSplitSliceIntoBlocks(t *testing.T) {
 		t.Error("Block is not as expected")
 	}
 }
+
+func TestNumberOfApiCallsRequiredWithAvoid(t *testing.T) {
+	apiKey := ""
+	api := NewDistanceMatrixAPI(apiKey, GoogleForWorkAccount, "en-GB", ImperialUnit)
+	opts := &RequestOptions{Avoid: Tolls | Highways | Ferries}
+
+	origins := []Coordinates{
+		Coordinates{
+			Latitude:  55.853551,
+			Longitude: -4.311093,
+		},
+	}
+
+	// Grow the destination addresses until the avoid parameter alone pushes
+	// the url over the limit
+	var destinations []Location
+	for n := 1; len(destinations) == 0 || numberOfApiCalls(t, api, LocationsFromCoordinates(origins), destinations, Driving, opts) == 1; n++ {
+		destinations = nil
+		for i := 0; i < 10; i++ {
+			destinations = append(destinations, Address(strings.Repeat("a", n)))
+		}
+	}
+
+	if numberOfApiCalls(t, api, LocationsFromCoordinates(origins), destinations, Driving, nil) != 1 {
+		t.Error("Avoid parameter is not accounted for in the url length")
+	}
+}
+
+func TestDecodeDurationInTraffic(t *testing.T) {
+	body := `{
+		"destination_addresses": ["Manchester, UK"],
+		"origin_addresses": ["Glasgow, UK"],
+		"rows": [{
+			"elements": [{
+				"distance": {"text": "215 mi", "value": 346050},
+				"duration": {"text": "3 hours 35 mins", "value": 12900},
+				"duration_in_traffic": {"text": "4 hours 2 mins", "value": 14520},
+				"status": "OK"
+			}]
+		}],
+		"status": "OK"
+	}`
+
+	var apiResponse ApiResponse
+	if err := json.Unmarshal([]byte(body), &apiResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	element := apiResponse.Rows[0].Elements[0]
+	if element.Duration.Value != 12900 {
+		t.Error("Duration is not as expected")
+	}
+	if element.DurationInTraffic.Value != 14520 || element.DurationInTraffic.Text != "4 hours 2 mins" {
+		t.Error("Duration in traffic is not as expected")
+	}
+}
+
+func TestNumberOfApiCallsRequiredWithPolylineEncoding(t *testing.T) {
+	apiKey := ""
+	api := NewDistanceMatrixAPI(apiKey, GoogleForWorkAccount, "en-GB", ImperialUnit)
+
+	// 25 x 25 is within the per request limits, only the url is too long for
+	// plain coordinates with every decimal
+	var origins, destinations []Location
+	for i := 0; i < 25; i++ {
+		origins = append(origins, Coordinates{
+			Latitude:  55.853551 + float64(i)/7,
+			Longitude: -4.311093 - float64(i)/7,
+		})
+		destinations = append(destinations, Coordinates{
+			Latitude:  53.47 + float64(i)/7,
+			Longitude: -2.33 - float64(i)/7,
+		})
+	}
+
+	plain := numberOfApiCalls(t, api, origins, destinations, Driving, nil)
+	encoded := numberOfApiCalls(t, api, origins, destinations, Driving, &RequestOptions{PolylineEncoding: true})
+	if plain < 2 {
+		t.Errorf("Plain coordinates should exceed the url length limit, got %d call", plain)
+	}
+	if encoded != 1 {
+		t.Errorf("Encoded polyline should fit in a single call, got %d calls", encoded)
+	}
+}
+
+func TestMergeSplitResponses(t *testing.T) {
+	apiKey := ""
+	api := NewDistanceMatrixAPI(apiKey, FreeAccount, "en-GB", ImperialUnit)
+
+	var origins []Location
+	for i := 0; i < 2; i++ {
+		origins = append(origins, Address(fmt.Sprintf("origin %d", i)))
+	}
+	var destinations []Location
+	for i := 0; i < 7; i++ {
+		destinations = append(destinations, Address(fmt.Sprintf("destination %d", i)))
+	}
+
+	// Destinations are split, each call returns every origin
+	api.maxElementsPerRequest = 6
+	calls, err := api.planCalls(origins, destinations, Driving, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) < 2 {
+		t.Fatal("Destinations should have been split")
+	}
+
+	joinedResponse := newApiResponse(len(origins), len(destinations))
+	for _, call := range calls {
+		resp := ApiResponse{Status: "OK"}
+		for _, o := range call.Origins {
+			resp.OriginAddresses = append(resp.OriginAddresses, o.String())
+		}
+		for _, d := range call.Destinations {
+			resp.DestinationAddresses = append(resp.DestinationAddresses, d.String())
+		}
+		for i := range call.Origins {
+			var row ApiRow
+			for j := range call.Destinations {
+				var element ApiElement
+				element.Distance.Value = float64((call.OriginOffset+i)*100 + call.DestinationOffset + j)
+				row.Elements = append(row.Elements, element)
+			}
+			resp.Rows = append(resp.Rows, row)
+		}
+		joinedResponse.merge(call, &resp)
+	}
+
+	if len(joinedResponse.Rows) != len(origins) {
+		t.Fatal("Row count does not match origin count")
+	}
+	for i, r := range joinedResponse.Rows {
+		if len(r.Elements) != len(destinations) {
+			t.Fatal("Element count does not match destination count")
+		}
+		for j, e := range r.Elements {
+			if e.Distance.Value != float64(i*100+j) {
+				t.Errorf("Element %d,%d is not at its place", i, j)
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(joinedResponse.OriginAddresses, []string{"origin 0", "origin 1"}) {
+		t.Error("Origin addresses are not as expected")
+	}
+	for j, address := range joinedResponse.DestinationAddresses {
+		if address != destinations[j].String() {
+			t.Error("Destination addresses are not as expected")
+		}
+	}
+}
+
+// distanceMatrixHandler answers distance matrix requests with elements whose
+// distance text names the origin and destination they were computed for.
+func distanceMatrixHandler(w http.ResponseWriter, r *http.Request) {
+	origins := strings.Split(r.URL.Query().Get("origins"), "|")
+	destinations := strings.Split(r.URL.Query().Get("destinations"), "|")
+
+	apiResponse := ApiResponse{
+		OriginAddresses:      origins,
+		DestinationAddresses: destinations,
+		Status:               "OK",
+	}
+	for _, o := range origins {
+		var row ApiRow
+		for _, d := range destinations {
+			var element ApiElement
+			element.Distance.Text = o + " -> " + d
+			element.Status = "OK"
+			row.Elements = append(row.Elements, element)
+		}
+		apiResponse.Rows = append(apiResponse.Rows, row)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiResponse)
+}
+
+func TestGetDistancesWithBaseURL(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/maps/api/distancematrix/json" || r.URL.Query().Get("key") != "key" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		distanceMatrixHandler(w, r)
+	}))
+	defer server.Close()
+
+	apiKey := "key"
+	api := NewDistanceMatrixAPI(apiKey, FreeAccount, "en-GB", ImperialUnit)
+	api.SetBaseURL(server.URL + "/")
+	api.SetHTTPClient(server.Client())
+	api.maxElementsPerRequest = 4
+
+	var origins []Location
+	for i := 0; i < 3; i++ {
+		origins = append(origins, Address(fmt.Sprintf("origin %d", i)))
+	}
+	var destinations []Location
+	for i := 0; i < 5; i++ {
+		destinations = append(destinations, Address(fmt.Sprintf("destination %d", i)))
+	}
+
+	resp, err := api.GetDistancesWithOptions(context.Background(), origins, destinations, Driving, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&requests) < 2 {
+		t.Error("Request should have been split")
+	}
+	for i, r := range resp.Rows {
+		for j, e := range r.Elements {
+			if e.Distance.Text != origins[i].String()+" -> "+destinations[j].String() {
+				t.Errorf("Element %d,%d is not at its place", i, j)
+			}
+		}
+	}
+	if !reflect.DeepEqual(resp.OriginAddresses, []string{"origin 0", "origin 1", "origin 2"}) {
+		t.Error("Origin addresses are not as expected")
+	}
+}
+
+func TestGetDistancesThrottleRespectsContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(distanceMatrixHandler))
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithRateLimit(1, 10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.maxElementsPerRequest = 1
+
+	origins := []Location{Address("Glasgow, UK"), Address("Edinburgh, UK")}
+	destinations := []Location{Address("Manchester, UK")}
+
+	// The deadline cannot accommodate the 10 seconds wait between the two calls
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err = api.GetDistancesWithOptions(ctx, origins, destinations, Driving, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a deadline exceeded error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("GetDistances should have failed fast")
+	}
+
+	// Without deadline, cancelling the context interrupts the wait
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	_, err = api.GetDistancesWithOptions(ctx, origins, destinations, Driving, nil)
+	if err != context.Canceled {
+		t.Errorf("Expected a canceled error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("GetDistances should have returned once cancelled")
+	}
+}
+
+func TestGetDistancesConcurrently(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		distanceMatrixHandler(w, r)
+	}))
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithConcurrency(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.maxElementsPerRequest = 1
+
+	origins := []Location{Address("origin 0"), Address("origin 1")}
+	destinations := []Location{Address("destination 0"), Address("destination 1"), Address("destination 2"), Address("destination 3")}
+
+	resp, err := api.GetDistancesWithOptions(context.Background(), origins, destinations, Driving, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&maxInFlight) != 4 {
+		t.Errorf("Expected 4 calls in flight, got %d", atomic.LoadInt32(&maxInFlight))
+	}
+	for i, r := range resp.Rows {
+		for j, e := range r.Elements {
+			if e.Distance.Text != origins[i].String()+" -> "+destinations[j].String() {
+				t.Errorf("Element %d,%d is not at its place", i, j)
+			}
+		}
+	}
+	if !reflect.DeepEqual(resp.DestinationAddresses, []string{"destination 0", "destination 1", "destination 2", "destination 3"}) {
+		t.Error("Destination addresses are not as expected")
+	}
+}
+
+func TestGetDistancesConcurrentlyStopsAtFirstError(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Write([]byte(`{"status": "REQUEST_DENIED"}`))
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		distanceMatrixHandler(w, r)
+	}))
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.maxElementsPerRequest = 1
+
+	var origins []Location
+	for i := 0; i < 20; i++ {
+		origins = append(origins, Address(fmt.Sprintf("origin %d", i)))
+	}
+
+	_, err = api.GetDistancesWithOptions(context.Background(), origins, []Location{Address("destination")}, Driving, nil)
+	if !errors.Is(err, ErrRequestDenied) {
+		t.Errorf("Expected a request denied error, got %v", err)
+	}
+	if atomic.LoadInt32(&requests) > 3 {
+		t.Errorf("Calls should stop after the first error, got %d requests", atomic.LoadInt32(&requests))
+	}
+}
+
+func TestGetDistancesPartially(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if strings.HasPrefix(r.URL.Query().Get("origins"), "origin 1") {
+			w.Write([]byte(`{"status": "REQUEST_DENIED"}`))
+			return
+		}
+		distanceMatrixHandler(w, r)
+	}))
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.maxElementsPerRequest = 2
+
+	origins := []Location{Address("origin 0"), Address("origin 1"), Address("origin 2")}
+	destinations := []Location{Address("destination 0"), Address("destination 1"), Address("destination 2")}
+
+	resp, err := api.GetDistancesWithOptions(context.Background(), origins, destinations, Driving, &RequestOptions{Partial: true})
+	var partialErr *PartialError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("Expected a partial error, got %v", err)
+	}
+	if !errors.Is(err, ErrRequestDenied) {
+		t.Error("Partial error should match the errors of the failed calls")
+	}
+	if atomic.LoadInt32(&requests) != 6 || partialErr.Calls != 6 {
+		t.Errorf("Every call should have been sent, got %d requests", atomic.LoadInt32(&requests))
+	}
+	if len(partialErr.Failed) != 2 || partialErr.Failed[0].Call.DestinationOffset != 0 || partialErr.Failed[1].Call.DestinationOffset != 2 {
+		t.Fatalf("Expected the 2 calls of origin 1 to fail, got %v", partialErr.Failed)
+	}
+
+	for i, r := range resp.Rows {
+		for j, e := range r.Elements {
+			if i == 1 && e.Status != "" {
+				t.Errorf("Element %d,%d of a failed call should be empty", i, j)
+			}
+			if i != 1 && e.Distance.Text != origins[i].String()+" -> "+destinations[j].String() {
+				t.Errorf("Element %d,%d is not at its place", i, j)
+			}
+		}
+	}
+}
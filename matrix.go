@@ -0,0 +1,224 @@
+package gogoogledm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrElementNotFound               = errors.New("origin and/or destination could not be geocoded")
+	ErrElementZeroResults            = errors.New("no route could be found between the origin and destination")
+	ErrElementMaxRouteLengthExceeded = errors.New("route is too long to be processed")
+	ErrElementUnknownStatus          = errors.New("unknown element status")
+)
+
+// ElementStatus is the status of a single origin and destination pair.
+type ElementStatus string
+
+const (
+	ElementOK                     ElementStatus = "OK"
+	ElementNotFound               ElementStatus = "NOT_FOUND"
+	ElementZeroResults            ElementStatus = "ZERO_RESULTS"
+	ElementMaxRouteLengthExceeded ElementStatus = "MAX_ROUTE_LENGTH_EXCEEDED"
+)
+
+// ElementError is the error of an element whose status is not OK. It
+// matches the sentinel error of the status with errors.Is, for instance
+// ErrElementNotFound for NOT_FOUND.
+type ElementError struct {
+	Origin      Location
+	Destination Location
+	Status      ElementStatus
+	err         error
+}
+
+func (e *ElementError) Error() string {
+	return fmt.Sprintf("%s to %s: %s: %v", e.Origin, e.Destination, e.Status, e.err)
+}
+
+func (e *ElementError) Unwrap() error {
+	return e.err
+}
+
+// Element is the route between an origin and a destination.
+type Element struct {
+	Origin      Location
+	Destination Location
+	Status      ElementStatus
+	// Distance is the length of the route, in meters whatever the unit system.
+	Distance int
+	Duration time.Duration
+	// DurationInTraffic is only set for driving requests with a departure time.
+	DurationInTraffic time.Duration
+	// DistanceText and DurationText are formatted in the language and unit
+	// system of the request.
+	DistanceText string
+	DurationText string
+	// Fare is only set for transit requests, when available.
+	Fare Fare
+	// err is the error of the call of the element, when it failed in a
+	// partial request.
+	err error
+}
+
+type Fare struct {
+	Currency string
+	Value    float64
+}
+
+// Err returns nil if the status of the element is OK, and an *ElementError
+// otherwise. The error of an element whose call failed in a partial request
+// wraps the error of the call.
+func (e Element) Err() error {
+	var err error
+	switch {
+	case e.err != nil:
+		err = e.err
+	case e.Status == ElementOK:
+		return nil
+	case e.Status == ElementNotFound:
+		err = ErrElementNotFound
+	case e.Status == ElementZeroResults:
+		err = ErrElementZeroResults
+	case e.Status == ElementMaxRouteLengthExceeded:
+		err = ErrElementMaxRouteLengthExceeded
+	default:
+		err = ErrElementUnknownStatus
+	}
+
+	return &ElementError{
+		Origin:      e.Origin,
+		Destination: e.Destination,
+		Status:      e.Status,
+		err:         err,
+	}
+}
+
+// FailedPair is an origin and destination pair whose element has an error.
+type FailedPair struct {
+	OriginIndex      int
+	DestinationIndex int
+	Err              error
+}
+
+// Matrix holds the elements of every origin and destination pair of a
+// request, the element at row i and column j being the route from the
+// origin i to the destination j.
+type Matrix struct {
+	Origins              []Location
+	Destinations         []Location
+	OriginAddresses      []string
+	DestinationAddresses []string
+	elements             [][]Element
+}
+
+// NewMatrix builds a matrix from the response of GetDistancesWithOptions
+// for origins and destinations.
+func NewMatrix(origins []Location, destinations []Location, apiResponse *ApiResponse) *Matrix {
+	matrix := Matrix{
+		Origins:              origins,
+		Destinations:         destinations,
+		OriginAddresses:      apiResponse.OriginAddresses,
+		DestinationAddresses: apiResponse.DestinationAddresses,
+		elements:             make([][]Element, len(apiResponse.Rows)),
+	}
+
+	for i, r := range apiResponse.Rows {
+		matrix.elements[i] = make([]Element, len(r.Elements))
+		for j, e := range r.Elements {
+			matrix.elements[i][j] = Element{
+				Origin:            origins[i],
+				Destination:       destinations[j],
+				Status:            ElementStatus(e.Status),
+				Distance:          int(e.Distance.Value),
+				Duration:          time.Duration(e.Duration.Value) * time.Second,
+				DurationInTraffic: time.Duration(e.DurationInTraffic.Value) * time.Second,
+				DistanceText:      e.Distance.Text,
+				DurationText:      e.Duration.Text,
+				Fare: Fare{
+					Currency: e.Fare.Currency,
+					Value:    e.Fare.Value,
+				},
+			}
+		}
+	}
+
+	return &matrix
+}
+
+// GetMatrix is like GetDistancesWithOptions but returns a Matrix. When some
+// calls of a partial request failed, it returns the matrix along with the
+// *PartialError, and the elements of the failed calls return the error of
+// their call from Err.
+func (api *DistanceMatrixAPI) GetMatrix(ctx context.Context, origins []Location, destinations []Location, transportMode TransportMode, opts *RequestOptions) (*Matrix, error) {
+	apiResponse, err := api.GetDistancesWithOptions(ctx, origins, destinations, transportMode, opts)
+	if apiResponse == nil {
+		return nil, err
+	}
+
+	matrix := NewMatrix(origins, destinations, apiResponse)
+	if partialErr, ok := err.(*PartialError); ok {
+		for _, f := range partialErr.Failed {
+			matrix.setCallError(f)
+		}
+	}
+
+	return matrix, err
+}
+
+// setCallError sets the error of the failed call on its elements.
+func (m *Matrix) setCallError(f CallError) {
+	for _, i := range f.originIndexes {
+		for _, j := range f.destinationIndexes {
+			m.elements[i][j].err = f.Err
+		}
+	}
+}
+
+// At returns the element from the origin i to the destination j.
+func (m *Matrix) At(i int, j int) Element {
+	return m.elements[i][j]
+}
+
+// Row returns the elements from the origin i to every destination.
+func (m *Matrix) Row(i int) []Element {
+	row := make([]Element, len(m.elements[i]))
+	copy(row, m.elements[i])
+	return row
+}
+
+// Column returns the elements from every origin to the destination j.
+func (m *Matrix) Column(j int) []Element {
+	column := make([]Element, len(m.elements))
+	for i := range m.elements {
+		column[i] = m.elements[i][j]
+	}
+	return column
+}
+
+// Failures returns the pairs whose element has an error, row by row.
+func (m *Matrix) Failures() []FailedPair {
+	var failures []FailedPair
+	m.Each(func(i int, j int, e Element) {
+		if err := e.Err(); err != nil {
+			failures = append(failures, FailedPair{
+				OriginIndex:      i,
+				DestinationIndex: j,
+				Err:              err,
+			})
+		}
+	})
+
+	return failures
+}
+
+// Each calls fn for every element, row by row.
+func (m *Matrix) Each(fn func(i int, j int, e Element)) {
+	for i := range m.elements {
+		for j, e := range m.elements[i] {
+			fn(i, j, e)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package gogoogledm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewMatrix(t *testing.T) {
+	body := `{
+		"destination_addresses": ["Manchester, UK", "London, UK"],
+		"origin_addresses": ["Glasgow, UK"],
+		"rows": [{
+			"elements": [{
+				"distance": {"text": "215 mi", "value": 346050},
+				"duration": {"text": "3 hours 35 mins", "value": 12900},
+				"duration_in_traffic": {"text": "4 hours 2 mins", "value": 14520},
+				"status": "OK"
+			}, {
+				"status": "ZERO_RESULTS"
+			}]
+		}],
+		"status": "OK"
+	}`
+
+	var apiResponse ApiResponse
+	if err := json.Unmarshal([]byte(body), &apiResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	origins := []Location{Address("Glasgow")}
+	destinations := []Location{Address("Manchester"), Address("London")}
+	matrix := NewMatrix(origins, destinations, &apiResponse)
+
+	e := matrix.At(0, 0)
+	if e.Origin != origins[0] || e.Destination != destinations[0] {
+		t.Error("Element locations are not as expected")
+	}
+	if e.Status != ElementOK || e.Distance != 346050 || e.DistanceText != "215 mi" {
+		t.Error("Element distance is not as expected")
+	}
+	if e.Duration != 3*time.Hour+35*time.Minute || e.DurationInTraffic != 4*time.Hour+2*time.Minute {
+		t.Error("Element durations are not as expected")
+	}
+	if matrix.At(0, 1).Status != ElementZeroResults {
+		t.Error("Element status is not as expected")
+	}
+
+	if len(matrix.Row(0)) != 2 || len(matrix.Column(1)) != 1 || matrix.Column(1)[0].Destination != destinations[1] {
+		t.Error("Row and column are not as expected")
+	}
+
+	count := 0
+	matrix.Each(func(i, j int, e Element) {
+		if e.Origin != origins[i] || e.Destination != destinations[j] {
+			t.Errorf("Element %d,%d is not at its place", i, j)
+		}
+		count++
+	})
+	if count != 2 {
+		t.Error("Each did not visit every element")
+	}
+}
+
+func TestGetMatrix(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(distanceMatrixHandler))
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origins := []Location{Address("Glasgow, UK"), PlaceID("ChIJ2eUgeAK6j4ARbn5u_wAGqWA")}
+	destinations := []Location{Address("Manchester, UK")}
+	matrix, err := api.GetMatrix(context.Background(), origins, destinations, Driving, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if matrix.At(1, 0).DistanceText != "place_id:ChIJ2eUgeAK6j4ARbn5u_wAGqWA -> Manchester, UK" {
+		t.Error("Element is not at its place")
+	}
+	if matrix.At(1, 0).Origin != origins[1] {
+		t.Error("Element should keep its original location")
+	}
+}
+
+func TestMatrixFailures(t *testing.T) {
+	apiResponse := newApiResponse(2, 2)
+	apiResponse.Rows[0].Elements[0].Status = "OK"
+	apiResponse.Rows[0].Elements[1].Status = "NOT_FOUND"
+	apiResponse.Rows[1].Elements[0].Status = "MAX_ROUTE_LENGTH_EXCEEDED"
+	apiResponse.Rows[1].Elements[1].Status = "ZERO_RESULTS"
+
+	origins := []Location{Address("Glasgow"), Address("Nowhere")}
+	destinations := []Location{Address("Manchester"), Address("Honolulu")}
+	matrix := NewMatrix(origins, destinations, apiResponse)
+
+	if matrix.At(0, 0).Err() != nil {
+		t.Error("OK element should not have an error")
+	}
+
+	var elementErr *ElementError
+	if !errors.As(matrix.At(0, 1).Err(), &elementErr) || elementErr.Destination != destinations[1] || elementErr.Status != ElementNotFound {
+		t.Error("Element error is not as expected")
+	}
+
+	failures := matrix.Failures()
+	expected := []struct {
+		i, j int
+		err  error
+	}{
+		{0, 1, ErrElementNotFound},
+		{1, 0, ErrElementMaxRouteLengthExceeded},
+		{1, 1, ErrElementZeroResults},
+	}
+	if len(failures) != len(expected) {
+		t.Fatalf("Expected %d failures, got %d", len(expected), len(failures))
+	}
+	for k, e := range expected {
+		f := failures[k]
+		if f.OriginIndex != e.i || f.DestinationIndex != e.j || !errors.Is(f.Err, e.err) {
+			t.Errorf("Failure %d is not as expected: %v", k, f.Err)
+		}
+	}
+}
+
+func TestGetMatrixPartially(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("destinations") == "destination 1" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		distanceMatrixHandler(w, r)
+	}))
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.maxElementsPerRequest = 1
+
+	origins := []Location{Address("origin 0"), Address("origin 1")}
+	destinations := []Location{Address("destination 0"), Address("destination 1")}
+
+	matrix, err := api.GetMatrix(context.Background(), origins, destinations, Driving, &RequestOptions{Partial: true})
+	if !errors.Is(err, ErrServerError) {
+		t.Fatalf("Expected a server error, got %v", err)
+	}
+
+	failures := matrix.Failures()
+	if len(failures) != 2 || failures[0].DestinationIndex != 1 || failures[1].DestinationIndex != 1 {
+		t.Fatalf("Expected the column of destination 1 to fail, got %v", failures)
+	}
+	var httpErr *HTTPError
+	if !errors.As(matrix.At(0, 1).Err(), &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Error("Failed element should wrap the error of its call")
+	}
+	if matrix.At(1, 0).Err() != nil || matrix.At(1, 0).DistanceText != "origin 1 -> destination 0" {
+		t.Error("Element of a successful call is not as expected")
+	}
+}
@@ -0,0 +1,126 @@
+package gogoogledm
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrConflictingDepartureTime          = errors.New("departure time and departure now are mutually exclusive")
+	ErrDepartureAndArrivalTime           = errors.New("departure time and arrival time cannot both be specified")
+	ErrArrivalTimeRequiresTransit        = errors.New("arrival time is only supported for transit requests")
+	ErrDepartureTimeInPast               = errors.New("departure time cannot be in the past for driving requests")
+	ErrTrafficModelRequiresDriving       = errors.New("traffic model is only supported for driving requests")
+	ErrTrafficModelRequiresDepartureTime = errors.New("traffic model requires a departure time")
+	ErrTransitOptionsRequireTransit      = errors.New("transit mode and transit routing preference are only supported for transit requests")
+)
+
+// RequestOptions holds the optional parameters of a distance matrix request.
+// A nil *RequestOptions is valid and sends none of them.
+type RequestOptions struct {
+	// DepartureTime is the desired time of departure. Leave it zero to omit it.
+	DepartureTime time.Time
+	// DepartureNow sets the time of departure to the current time, which
+	// Google resolves on its side. It cannot be combined with DepartureTime.
+	DepartureNow bool
+	// ArrivalTime is the desired time of arrival, for transit requests only.
+	ArrivalTime time.Time
+	// TrafficModel selects the assumptions used to compute the duration in
+	// traffic. It requires a departure time and the Driving mode.
+	TrafficModel TrafficModel
+	// Avoid lists the features the routes should avoid.
+	Avoid Avoid
+	// TransitMode lists the preferred modes of transit, for transit requests only.
+	TransitMode TransitMode
+	// TransitRoutingPreference biases the transit routes, for transit requests only.
+	TransitRoutingPreference TransitRoutingPreference
+	// PolylineEncoding sends lists made only of coordinates as encoded
+	// polylines, which are much shorter and so need fewer calls when the
+	// URL length is the limiting factor. Coordinates are then rounded to 5
+	// decimal places, about 1.1 meters.
+	PolylineEncoding bool
+	// Partial keeps sending the calls of a request after one of them failed.
+	// The response then holds the elements of the calls that succeeded, and
+	// the error is a *PartialError listing the calls that failed.
+	Partial bool
+}
+
+func (opts *RequestOptions) hasDepartureTime() bool {
+	return opts.DepartureNow || !opts.DepartureTime.IsZero()
+}
+
+// hasTraffic reports whether Google computes the duration in traffic, which
+// is the case of driving requests with a departure time.
+func (opts *RequestOptions) hasTraffic(transportMode TransportMode) bool {
+	return transportMode == Driving && opts != nil && opts.hasDepartureTime()
+}
+
+func (opts *RequestOptions) polylineEncoding() bool {
+	return opts != nil && opts.PolylineEncoding
+}
+
+func (opts *RequestOptions) partial() bool {
+	return opts != nil && opts.Partial
+}
+
+func (opts *RequestOptions) validate(transportMode TransportMode) error {
+	if opts == nil {
+		return nil
+	}
+
+	if opts.DepartureNow && !opts.DepartureTime.IsZero() {
+		return ErrConflictingDepartureTime
+	}
+	if opts.hasDepartureTime() && !opts.ArrivalTime.IsZero() {
+		return ErrDepartureAndArrivalTime
+	}
+	if !opts.ArrivalTime.IsZero() && transportMode != Transit {
+		return ErrArrivalTimeRequiresTransit
+	}
+	// Google only computes traffic for the present or the future.
+	if transportMode == Driving && !opts.DepartureTime.IsZero() && opts.DepartureTime.Before(time.Now()) {
+		return ErrDepartureTimeInPast
+	}
+	if opts.TrafficModel != 0 {
+		if transportMode != Driving {
+			return ErrTrafficModelRequiresDriving
+		}
+		if !opts.hasDepartureTime() {
+			return ErrTrafficModelRequiresDepartureTime
+		}
+	}
+	if (opts.TransitMode != 0 || opts.TransitRoutingPreference != 0) && transportMode != Transit {
+		return ErrTransitOptionsRequireTransit
+	}
+
+	return nil
+}
+
+func (opts *RequestOptions) addUrlParams(params url.Values) {
+	if opts == nil {
+		return
+	}
+
+	if opts.DepartureNow {
+		params.Add("departure_time", "now")
+	} else if !opts.DepartureTime.IsZero() {
+		params.Add("departure_time", strconv.FormatInt(opts.DepartureTime.Unix(), 10))
+	}
+	if !opts.ArrivalTime.IsZero() {
+		params.Add("arrival_time", strconv.FormatInt(opts.ArrivalTime.Unix(), 10))
+	}
+	if opts.TrafficModel != 0 {
+		params.Add("traffic_model", opts.TrafficModel.String())
+	}
+	if opts.Avoid != 0 {
+		params.Add("avoid", opts.Avoid.String())
+	}
+	if opts.TransitMode != 0 {
+		params.Add("transit_mode", opts.TransitMode.String())
+	}
+	if opts.TransitRoutingPreference != 0 {
+		params.Add("transit_routing_preference", opts.TransitRoutingPreference.String())
+	}
+}
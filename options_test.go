@@ -0,0 +1,90 @@
+package gogoogledm
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRequestOptionsValidate(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		opts          *RequestOptions
+		transportMode TransportMode
+		err           error
+	}{
+		{nil, Driving, nil},
+		{&RequestOptions{DepartureNow: true, TrafficModel: BestGuess}, Driving, nil},
+		{&RequestOptions{DepartureTime: future, TrafficModel: Pessimistic}, Driving, nil},
+		{&RequestOptions{ArrivalTime: future}, Transit, nil},
+		{&RequestOptions{DepartureTime: past}, Transit, nil},
+		{&RequestOptions{DepartureNow: true, DepartureTime: future}, Driving, ErrConflictingDepartureTime},
+		{&RequestOptions{DepartureTime: future, ArrivalTime: future}, Transit, ErrDepartureAndArrivalTime},
+		{&RequestOptions{ArrivalTime: future}, Driving, ErrArrivalTimeRequiresTransit},
+		{&RequestOptions{DepartureTime: past}, Driving, ErrDepartureTimeInPast},
+		{&RequestOptions{DepartureNow: true, TrafficModel: Optimistic}, Transit, ErrTrafficModelRequiresDriving},
+		{&RequestOptions{TrafficModel: BestGuess}, Driving, ErrTrafficModelRequiresDepartureTime},
+		{&RequestOptions{TransitMode: Bus | Rail, TransitRoutingPreference: LessWalking}, Transit, nil},
+		{&RequestOptions{TransitMode: Subway}, Driving, ErrTransitOptionsRequireTransit},
+		{&RequestOptions{TransitRoutingPreference: FewerTransfers}, Walking, ErrTransitOptionsRequireTransit},
+	}
+
+	for i, test := range tests {
+		if err := test.opts.validate(test.transportMode); err != test.err {
+			t.Errorf("Test %d: expected error %v, got %v", i, test.err, err)
+		}
+	}
+}
+
+func TestRequestOptionsUrlParams(t *testing.T) {
+	params := url.Values{}
+	opts := &RequestOptions{
+		DepartureTime: time.Unix(1700000000, 0),
+		TrafficModel:  Pessimistic,
+	}
+	opts.addUrlParams(params)
+
+	if params.Get("departure_time") != "1700000000" {
+		t.Error("departure_time param is not as expected")
+	}
+	if params.Get("traffic_model") != "pessimistic" {
+		t.Error("traffic_model param is not as expected")
+	}
+	if _, ok := params["arrival_time"]; ok {
+		t.Error("arrival_time param should not be set")
+	}
+
+	params = url.Values{}
+	opts = &RequestOptions{DepartureNow: true}
+	opts.addUrlParams(params)
+	if params.Get("departure_time") != "now" {
+		t.Error("departure_time param should be now")
+	}
+}
+
+func TestAvoidString(t *testing.T) {
+	if Tolls.String() != "tolls" {
+		t.Error("Single restriction is not as expected")
+	}
+	if (Ferries | Tolls | Indoor).String() != "tolls|ferries|indoor" {
+		t.Error("Combined restrictions are not as expected")
+	}
+}
+
+func TestTransitOptionsUrlParams(t *testing.T) {
+	params := url.Values{}
+	opts := &RequestOptions{
+		TransitMode:              Bus | Tram,
+		TransitRoutingPreference: FewerTransfers,
+	}
+	opts.addUrlParams(params)
+
+	if params.Get("transit_mode") != "bus|tram" {
+		t.Error("transit_mode param is not as expected")
+	}
+	if params.Get("transit_routing_preference") != "fewer_transfers" {
+		t.Error("transit_routing_preference param is not as expected")
+	}
+}
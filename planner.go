@@ -0,0 +1,251 @@
+package gogoogledm
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+var ErrUrlTooLong = errors.New("a single origin and destination exceed the maximum url length")
+
+// Plan returns the calls GetDistancesWithOptions sends for a request along
+// with their cost, without sending anything. The cache is not looked up, so
+// with a cache the calls are the ones of a request missing every pair.
+func (api *DistanceMatrixAPI) Plan(origins []Location, destinations []Location, transportMode TransportMode, opts *RequestOptions) (*QueryPlan, error) {
+	origins = quantizeLocations(api.requestQuantizer, origins)
+	destinations = quantizeLocations(api.requestQuantizer, destinations)
+
+	return api.planRequest(origins, destinations, transportMode, opts)
+}
+
+// planRequest is like Plan for locations already quantized.
+func (api *DistanceMatrixAPI) planRequest(origins []Location, destinations []Location, transportMode TransportMode, opts *RequestOptions) (*QueryPlan, error) {
+	if err := opts.validate(transportMode); err != nil {
+		return nil, err
+	}
+
+	apiCalls, err := api.planCalls(origins, destinations, transportMode, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.newQueryPlan(apiCalls, transportMode, opts)
+}
+
+// newQueryPlan returns the plan of the calls, sent in that order.
+func (api *DistanceMatrixAPI) newQueryPlan(apiCalls []ApiCall, transportMode TransportMode, opts *RequestOptions) (*QueryPlan, error) {
+	baseLength, err := api.baseUrlLength(transportMode, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := QueryPlan{
+		Calls:    make([]PlannedCall, len(apiCalls)),
+		Advanced: opts.hasTraffic(transportMode),
+	}
+	// The waits are estimated with the token bucket of the default rate
+	// limiter, starting full and used by this request only.
+	capacity := float64(api.elementsPerWindow)
+	rate := capacity / float64(api.window)
+	tokens := capacity
+	for i, call := range apiCalls {
+		need := len(call.Origins) * len(call.Destinations)
+		var wait time.Duration
+		if tokens < minFloat(capacity, float64(need)) {
+			wait = time.Duration((minFloat(capacity, float64(need)) - tokens) / rate)
+			tokens += float64(wait) * rate
+		}
+		tokens -= float64(need)
+
+		plan.Calls[i] = PlannedCall{
+			ApiCall:   call,
+			Elements:  need,
+			UrlLength: baseLength + encodedLength(call.Origins, opts.polylineEncoding()) + encodedLength(call.Destinations, opts.polylineEncoding()),
+			Wait:      wait,
+		}
+		plan.Elements += need
+		plan.ExpectedWait += wait
+	}
+
+	return &plan, nil
+}
+
+// planCalls tiles the origins x destinations matrix into rectangles of
+// contiguous origins and destinations. Every call respects the number of
+// locations and elements per request and the url length limits, and the tile size is
+// chosen to minimize the number of calls.
+func (api *DistanceMatrixAPI) planCalls(origins []Location, destinations []Location, transportMode TransportMode, opts *RequestOptions) ([]ApiCall, error) {
+	if len(origins) == 0 || len(destinations) == 0 {
+		return nil, nil
+	}
+
+	baseLength, err := api.baseUrlLength(transportMode, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	maxOrigins := minInt(len(origins), minInt(maxLocationsPerRequest, api.maxElementsPerRequest))
+	maxDestinations := minInt(len(destinations), minInt(maxLocationsPerRequest, api.maxElementsPerRequest))
+	originLengths := maxEncodedLengths(origins, maxOrigins, opts.polylineEncoding())
+	destinationLengths := maxEncodedLengths(destinations, maxDestinations, opts.polylineEncoding())
+
+	bestCalls, bestOrigins, bestDestinations := 0, 0, 0
+	for o := 1; o <= maxOrigins; o++ {
+		available := maxUrlLength - baseLength - originLengths[o]
+
+		// Take as many destinations as the element limit allows, then shrink
+		// until the longest tile fits in the url.
+		d := minInt(maxDestinations, api.maxElementsPerRequest/o)
+		for d > 0 && destinationLengths[d] > available {
+			d--
+		}
+		if d == 0 {
+			continue
+		}
+
+		calls := ceilDiv(len(origins), o) * ceilDiv(len(destinations), d)
+		if bestCalls == 0 || calls < bestCalls {
+			bestCalls, bestOrigins, bestDestinations = calls, o, d
+		}
+	}
+
+	if bestCalls == 0 {
+		return nil, ErrUrlTooLong
+	}
+
+	apiCalls := make([]ApiCall, 0, bestCalls)
+	originOffset := 0
+	for _, o := range splitSliceIntoBlocks(origins, bestOrigins) {
+		destinationOffset := 0
+		for _, d := range splitSliceIntoBlocks(destinations, bestDestinations) {
+			apiCalls = append(apiCalls, ApiCall{
+				Origins:           o,
+				Destinations:      d,
+				OriginOffset:      originOffset,
+				DestinationOffset: destinationOffset,
+			})
+			destinationOffset += len(d)
+		}
+		originOffset += len(o)
+	}
+
+	return apiCalls, nil
+}
+
+// baseUrlLength returns the length of an authentified request url with empty
+// origins and destinations.
+func (api *DistanceMatrixAPI) baseUrlLength(transportMode TransportMode, opts *RequestOptions) (int, error) {
+	urlValues := api.buildUrlParams(transportMode, opts)
+	urlValues.Add("origins", "")
+	urlValues.Add("destinations", "")
+
+	url, err := api.generateAuthentifiedURL(urlValues)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(url), nil
+}
+
+// maxEncodedLengths returns, for every block size up to maxBlockSize, the
+// length of the longest url encoded block of locations of that size.
+func maxEncodedLengths(locations []Location, maxBlockSize int, polylineEncoding bool) []int {
+	blocks := newBlockLengths(locations, polylineEncoding)
+	lengths := make([]int, maxBlockSize+1)
+	for size := 1; size <= maxBlockSize; size++ {
+		for start := 0; start < len(locations); start += size {
+			length := blocks.length(start, minInt(start+size, len(locations)))
+			if length > lengths[size] {
+				lengths[size] = length
+			}
+		}
+	}
+
+	return lengths
+}
+
+// blockLengths gives the encoded length of any block of contiguous locations
+// in constant time, from prefix sums of the encoded length of each location.
+// Url encoding escapes every byte on its own, so the length of a list is the
+// sum of the lengths of its locations and separators. A polyline encodes
+// every point but the first as a delta from the previous one, so its length
+// is the length of the first point plus the lengths of the deltas.
+type blockLengths struct {
+	polylineEncoding bool
+	// plain[i] is the total length of the first i locations.
+	plain []int
+	// nonCoordinates[i] is the number of locations that are not coordinates
+	// among the first i ones.
+	nonCoordinates []int
+	// point[i] is the length of location i encoded alone in a polyline, and
+	// deltas[i] the total length of the deltas of the first i locations from
+	// their previous one.
+	point  []int
+	deltas []int
+}
+
+var (
+	separatorLength      = len(url.QueryEscape("|"))
+	polylineHeaderLength = len(url.QueryEscape("enc:")) + len(url.QueryEscape(":"))
+)
+
+func newBlockLengths(locations []Location, polylineEncoding bool) *blockLengths {
+	n := len(locations)
+	b := blockLengths{
+		polylineEncoding: polylineEncoding,
+		plain:            make([]int, n+1),
+		nonCoordinates:   make([]int, n+1),
+		point:            make([]int, n),
+		deltas:           make([]int, n+1),
+	}
+
+	for i, l := range locations {
+		b.plain[i+1] = b.plain[i] + len(url.QueryEscape(l.String()))
+		if !polylineEncoding {
+			continue
+		}
+
+		c, ok := l.(Coordinates)
+		b.nonCoordinates[i+1] = b.nonCoordinates[i]
+		b.deltas[i+1] = b.deltas[i]
+		if !ok {
+			b.nonCoordinates[i+1]++
+			continue
+		}
+
+		b.point[i] = len(url.QueryEscape(EncodePolyline([]Coordinates{c})))
+		if i == 0 {
+			continue
+		}
+		if previous, ok := locations[i-1].(Coordinates); ok {
+			b.deltas[i+1] += len(url.QueryEscape(EncodePolyline([]Coordinates{previous, c}))) - b.point[i-1]
+		}
+	}
+
+	return &b
+}
+
+// length returns the encoded length of the locations from start to end excluded.
+func (b *blockLengths) length(start int, end int) int {
+	if b.polylineEncoding && b.nonCoordinates[end] == b.nonCoordinates[start] {
+		return polylineHeaderLength + b.point[start] + b.deltas[end] - b.deltas[start+1]
+	}
+
+	return b.plain[end] - b.plain[start] + (end-start-1)*separatorLength
+}
+
+// encodedLength returns the length of locations once url encoded.
+func encodedLength(locations []Location, polylineEncoding bool) int {
+	return len(url.QueryEscape(locationsSliceToString(locations, polylineEncoding)))
+}
+
+func ceilDiv(a int, b int) int {
+	return (a + b - 1) / b
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
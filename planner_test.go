@@ -0,0 +1,169 @@
+package gogoogledm
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanCallsLargeMatrix(t *testing.T) {
+	var origins []Location
+	var destinations []Location
+	for i := 0; i < 300; i++ {
+		origins = append(origins, Coordinates{
+			Latitude:  55.853551 + float64(i)/1000,
+			Longitude: -4.311093,
+		})
+		destinations = append(destinations, Address(fmt.Sprintf("%d Oxford Street, London", i)))
+	}
+
+	// The free account is bound by the elements per request, the other one by
+	// the locations per request
+	for _, account := range []AccountType{FreeAccount, GoogleForWorkAccount} {
+		testPlanCallsLargeMatrix(t, NewDistanceMatrixAPI("", account, "en-GB", ImperialUnit), origins, destinations)
+	}
+}
+
+func testPlanCallsLargeMatrix(t *testing.T, api *DistanceMatrixAPI, origins []Location, destinations []Location) {
+	plan, err := api.Plan(origins, destinations, Driving, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Elements != len(origins)*len(destinations) {
+		t.Error("Plan elements do not match the matrix size")
+	}
+
+	covered := make([][]int, len(origins))
+	for i := range covered {
+		covered[i] = make([]int, len(destinations))
+	}
+
+	for _, call := range plan.Calls {
+		if call.Elements > api.maxElementsPerRequest {
+			t.Error("Call exceeds the elements per request limit")
+		}
+		if call.UrlLength > maxUrlLength {
+			t.Error("Call exceeds the url length limit")
+		}
+		if len(call.Origins) > maxLocationsPerRequest || len(call.Destinations) > maxLocationsPerRequest {
+			t.Errorf("Call has %d origins and %d destinations, over the 25 per request limit", len(call.Origins), len(call.Destinations))
+		}
+		for i := range call.Origins {
+			for j := range call.Destinations {
+				covered[call.OriginOffset+i][call.DestinationOffset+j]++
+			}
+		}
+	}
+
+	for i := range covered {
+		for j := range covered[i] {
+			if covered[i][j] != 1 {
+				t.Fatalf("Element %d,%d is covered %d times", i, j, covered[i][j])
+			}
+		}
+	}
+}
+
+func TestPlanCallsUrlTooLong(t *testing.T) {
+	apiKey := ""
+	api := NewDistanceMatrixAPI(apiKey, FreeAccount, "en-GB", ImperialUnit)
+
+	origins := []Location{Address(strings.Repeat("a", maxUrlLength))}
+	destinations := []Location{Address("London")}
+
+	if _, err := api.planCalls(origins, destinations, Driving, nil); err != ErrUrlTooLong {
+		t.Error("Plan should fail when a single location exceeds the url length")
+	}
+}
+
+func TestPlanCallsEmpty(t *testing.T) {
+	apiKey := ""
+	api := NewDistanceMatrixAPI(apiKey, FreeAccount, "en-GB", ImperialUnit)
+
+	apiCalls, err := api.planCalls(nil, []Location{Address("London")}, Driving, nil)
+	if err != nil || len(apiCalls) != 0 {
+		t.Error("Plan without origins should be empty")
+	}
+}
+
+func TestPlanUrlLength(t *testing.T) {
+	apiKey := "key"
+	api := NewDistanceMatrixAPI(apiKey, FreeAccount, "en-GB", ImperialUnit)
+	opts := &RequestOptions{Avoid: Tolls}
+
+	origins := []Location{Address("Glasgow, UK")}
+	destinations := []Location{Address("Manchester, UK"), PlaceID("ChIJ2eUgeAK6j4ARbn5u_wAGqWA")}
+
+	plan, err := api.Plan(origins, destinations, Driving, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urlValues := api.buildUrlParams(Driving, opts)
+	urlValues.Add("origins", locationsSliceToString(origins, false))
+	urlValues.Add("destinations", locationsSliceToString(destinations, false))
+	url, _ := api.generateAuthentifiedURL(urlValues)
+
+	if len(plan.Calls) != 1 || plan.Calls[0].UrlLength != len(url) {
+		t.Error("Planned url length does not match the sent url")
+	}
+}
+
+func TestPlanExpectedWait(t *testing.T) {
+	apiKey := ""
+	api := NewDistanceMatrixAPI(apiKey, FreeAccount, "en-GB", ImperialUnit)
+
+	var origins []Location
+	for i := 0; i < 25; i++ {
+		origins = append(origins, Address(fmt.Sprintf("origin %d", i)))
+	}
+	var destinations []Location
+	for i := 0; i < 10; i++ {
+		destinations = append(destinations, Address(fmt.Sprintf("destination %d", i)))
+	}
+
+	plan, err := api.Plan(origins, destinations, Driving, &RequestOptions{DepartureNow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 250 elements at 100 elements per 10 seconds, the first 100 are sent right away
+	if plan.Elements != 250 || len(plan.Calls) != 3 {
+		t.Error("Plan is not as expected")
+	}
+	if plan.ExpectedWait != 15*time.Second {
+		t.Error("Expected wait is not as expected")
+	}
+	if !plan.Advanced {
+		t.Error("Traffic aware request should be billed at the advanced rate")
+	}
+}
+
+func TestMaxEncodedLengths(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var locations []Location
+	for i := 0; i < 60; i++ {
+		if i%7 == 3 {
+			locations = append(locations, Address(fmt.Sprintf("Rue de l'Église %d, Paris", i)))
+			continue
+		}
+		locations = append(locations, Coordinates{Latitude: r.Float64()*180 - 90, Longitude: r.Float64()*360 - 180})
+	}
+
+	for _, polylineEncoding := range []bool{false, true} {
+		lengths := maxEncodedLengths(locations, 25, polylineEncoding)
+		for size := 1; size <= 25; size++ {
+			expected := 0
+			for _, b := range splitSliceIntoBlocks(locations, size) {
+				if length := encodedLength(b, polylineEncoding); length > expected {
+					expected = length
+				}
+			}
+			if lengths[size] != expected {
+				t.Errorf("Polyline %v, size %d: expected %d, got %d", polylineEncoding, size, expected, lengths[size])
+			}
+		}
+	}
+}
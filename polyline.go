@@ -0,0 +1,91 @@
+package gogoogledm
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+var ErrInvalidPolyline = errors.New("invalid encoded polyline")
+
+// EncodePolyline encodes coordinates with Google's polyline algorithm.
+// Coordinates are rounded to 5 decimal places, about 1.1 meters.
+// See: https://developers.google.com/maps/documentation/utilities/polylinealgorithm
+func EncodePolyline(coordinates []Coordinates) string {
+	var result strings.Builder
+	var previousLatitude, previousLongitude int64
+	for _, c := range coordinates {
+		latitude := int64(math.Round(c.Latitude * 1e5))
+		longitude := int64(math.Round(c.Longitude * 1e5))
+		encodePolylineValue(&result, latitude-previousLatitude)
+		encodePolylineValue(&result, longitude-previousLongitude)
+		previousLatitude, previousLongitude = latitude, longitude
+	}
+
+	return result.String()
+}
+
+func encodePolylineValue(result *strings.Builder, value int64) {
+	v := value << 1
+	if value < 0 {
+		v = ^v
+	}
+	for v >= 0x20 {
+		result.WriteByte(byte((0x20 | (v & 0x1f)) + 63))
+		v >>= 5
+	}
+	result.WriteByte(byte(v + 63))
+}
+
+// DecodePolyline decodes a polyline encoded with Google's polyline algorithm.
+func DecodePolyline(polyline string) ([]Coordinates, error) {
+	var coordinates []Coordinates
+	var latitude, longitude int64
+	for i := 0; i < len(polyline); {
+		deltaLatitude, n, err := decodePolylineValue(polyline[i:])
+		if err != nil {
+			return nil, err
+		}
+		i += n
+
+		deltaLongitude, n, err := decodePolylineValue(polyline[i:])
+		if err != nil {
+			return nil, err
+		}
+		i += n
+
+		latitude += deltaLatitude
+		longitude += deltaLongitude
+		coordinates = append(coordinates, Coordinates{
+			Latitude:  float64(latitude) / 1e5,
+			Longitude: float64(longitude) / 1e5,
+		})
+	}
+
+	return coordinates, nil
+}
+
+func decodePolylineValue(polyline string) (value int64, n int, err error) {
+	var v int64
+	var shift uint
+	for {
+		if n >= len(polyline) || shift > 60 {
+			return 0, 0, ErrInvalidPolyline
+		}
+		b := int64(polyline[n]) - 63
+		n++
+		if b < 0 || b > 0x3f {
+			return 0, 0, ErrInvalidPolyline
+		}
+		v |= (b & 0x1f) << shift
+		shift += 5
+		if b < 0x20 {
+			break
+		}
+	}
+
+	if v&1 != 0 {
+		return ^(v >> 1), n, nil
+	}
+	return v >> 1, n, nil
+}
@@ -0,0 +1,39 @@
+package gogoogledm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodePolyline(t *testing.T) {
+	// Example from https://developers.google.com/maps/documentation/utilities/polylinealgorithm
+	coordinates := []Coordinates{
+		Coordinates{Latitude: 38.5, Longitude: -120.2},
+		Coordinates{Latitude: 40.7, Longitude: -120.95},
+		Coordinates{Latitude: 43.252, Longitude: -126.453},
+	}
+
+	if EncodePolyline(coordinates) != "_p~iF~ps|U_ulLnnqC_mqNvxq`@" {
+		t.Error("Polyline is not as expected")
+	}
+}
+
+func TestDecodePolyline(t *testing.T) {
+	coordinates, err := DecodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Coordinates{
+		Coordinates{Latitude: 38.5, Longitude: -120.2},
+		Coordinates{Latitude: 40.7, Longitude: -120.95},
+		Coordinates{Latitude: 43.252, Longitude: -126.453},
+	}
+	if !reflect.DeepEqual(coordinates, expected) {
+		t.Error("Decoded coordinates are not as expected")
+	}
+
+	if _, err := DecodePolyline("_p~iF~ps|U_ulL"); err != ErrInvalidPolyline {
+		t.Error("Truncated polyline should be invalid")
+	}
+}
@@ -0,0 +1,117 @@
+package gogoogledm
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrInvalidQuantizer = errors.New("precision quantizer digits must be between 0 and 15 and geohash quantizer precision between 1 and 12")
+
+// Quantizer snaps locations to a grid, so that close coordinates, such as
+// two GPS fixes of the same parked car, become the same location.
+type Quantizer interface {
+	Quantize(location Location) Location
+}
+
+// PrecisionQuantizer rounds coordinates to Digits decimal places, between 0
+// and 15, past which float64 has no more digits. Other locations are left
+// unchanged.
+//
+// The worst-case error is half a unit of the last digit on each axis, that
+// is 78.7km / 10^Digits at the equator and less elsewhere: 7.9m for 4
+// digits, 79cm for 5 digits.
+type PrecisionQuantizer struct {
+	Digits int
+}
+
+func (q PrecisionQuantizer) validate() error {
+	if q.Digits < 0 || q.Digits > 15 {
+		return ErrInvalidQuantizer
+	}
+	return nil
+}
+
+func (q PrecisionQuantizer) Quantize(location Location) Location {
+	c, ok := location.(Coordinates)
+	if !ok {
+		return location
+	}
+
+	scale := math.Pow(10, float64(q.Digits))
+	return Coordinates{
+		Latitude:  math.Round(c.Latitude*scale) / scale,
+		Longitude: math.Round(c.Longitude*scale) / scale,
+	}
+}
+
+// GeohashQuantizer snaps coordinates to the center of their geohash cell of
+// Precision characters, between 1 and 12. Other locations are left unchanged.
+//
+// The worst-case error is half the diagonal of a cell at the equator, and
+// less elsewhere: 684m for 6 characters, 108m for 7, 21m for 8 and 3.4m for 9.
+type GeohashQuantizer struct {
+	Precision int
+}
+
+func (q GeohashQuantizer) validate() error {
+	if q.Precision < 1 || q.Precision > 12 {
+		return ErrInvalidQuantizer
+	}
+	return nil
+}
+
+func (q GeohashQuantizer) Quantize(location Location) Location {
+	c, ok := location.(Coordinates)
+	if !ok {
+		return location
+	}
+
+	// Geohash interleaves the bits of the longitude and latitude, starting
+	// with the longitude, 5 bits per character.
+	bits := 5 * q.Precision
+	return Coordinates{
+		Latitude:  snapToCellCenter(c.Latitude, -90, 90, bits/2),
+		Longitude: snapToCellCenter(c.Longitude, -180, 180, (bits+1)/2),
+	}
+}
+
+// snapToCellCenter returns the center of the cell of value, when [min, max]
+// is divided in 2^bits cells.
+func snapToCellCenter(value float64, min float64, max float64, bits int) float64 {
+	cells := math.Exp2(float64(bits))
+	size := (max - min) / cells
+
+	cell := math.Floor((value - min) / size)
+	if cell >= cells {
+		cell = cells - 1
+	}
+	if cell < 0 {
+		cell = 0
+	}
+
+	return min + (cell+0.5)*size
+}
+
+// validateQuantizer validates the quantizers of this package, which are
+// invalid for some values of their fields.
+func validateQuantizer(quantizer Quantizer) error {
+	if quantizer == nil {
+		return ErrNilQuantizer
+	}
+	if q, ok := quantizer.(interface{ validate() error }); ok {
+		return q.validate()
+	}
+	return nil
+}
+
+func quantizeLocations(quantizer Quantizer, locations []Location) []Location {
+	if quantizer == nil {
+		return locations
+	}
+
+	quantized := make([]Location, len(locations))
+	for i, l := range locations {
+		quantized[i] = quantizer.Quantize(l)
+	}
+	return quantized
+}
@@ -0,0 +1,159 @@
+package gogoogledm
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+)
+
+// distance returns the equirectangular distance in meters between a and b,
+// which is precise enough for close coordinates.
+func distance(a Coordinates, b Coordinates) float64 {
+	const metersPerDegree = 111320
+	x := (b.Longitude - a.Longitude) * math.Cos((a.Latitude+b.Latitude)/2*math.Pi/180)
+	y := b.Latitude - a.Latitude
+	return math.Hypot(x, y) * metersPerDegree
+}
+
+func TestQuantizersWorstCaseError(t *testing.T) {
+	tests := []struct {
+		quantizer Quantizer
+		maxError  float64
+	}{
+		{PrecisionQuantizer{Digits: 4}, 7.9},
+		{PrecisionQuantizer{Digits: 5}, 0.79},
+		{GeohashQuantizer{Precision: 7}, 108.1},
+		{GeohashQuantizer{Precision: 8}, 21.4},
+		{GeohashQuantizer{Precision: 9}, 3.4},
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for _, test := range tests {
+		for i := 0; i < 10000; i++ {
+			c := Coordinates{Latitude: r.Float64()*170 - 85, Longitude: r.Float64()*360 - 180}
+			q := test.quantizer.Quantize(c).(Coordinates)
+			if d := distance(c, q); d > test.maxError {
+				t.Fatalf("%#v moved %v to %v, %.2fm away", test.quantizer, c, q, d)
+			}
+			if test.quantizer.Quantize(q) != q {
+				t.Fatalf("%#v is not idempotent for %v", test.quantizer, c)
+			}
+		}
+	}
+}
+
+func TestQuantizers(t *testing.T) {
+	first := Coordinates{Latitude: 57.649111, Longitude: 10.407439}
+	second := Coordinates{Latitude: 57.649123, Longitude: 10.407451}
+
+	if q := (PrecisionQuantizer{Digits: 4}).Quantize(first); q != (Coordinates{Latitude: 57.6491, Longitude: 10.4074}) {
+		t.Errorf("Unexpected rounding %v", q)
+	}
+	if (GeohashQuantizer{Precision: 8}).Quantize(first) != (GeohashQuantizer{Precision: 8}).Quantize(second) {
+		t.Error("Close coordinates should be snapped to the same cell")
+	}
+	if (GeohashQuantizer{Precision: 8}).Quantize(Address("Glasgow")) != Address("Glasgow") {
+		t.Error("Addresses should be left unchanged")
+	}
+	if c := (GeohashQuantizer{Precision: 1}).Quantize(Coordinates{Latitude: 90, Longitude: 180}); c != (Coordinates{Latitude: 67.5, Longitude: 157.5}) {
+		t.Errorf("Bounds should be in the last cell, got %v", c)
+	}
+}
+
+func TestGetDistancesWithCacheQuantizer(t *testing.T) {
+	rec := &pairsRecorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithCache(NewLRUCache(100), 0), WithCacheQuantizer(PrecisionQuantizer{Digits: 4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	destinations := []Location{Address("destination")}
+	origin := Coordinates{Latitude: 55.853551, Longitude: -4.311093}
+	if _, err := api.GetDistancesWithOptions(context.Background(), []Location{origin}, destinations, Driving, nil); err != nil {
+		t.Fatal(err)
+	}
+	if pairs, _ := rec.reset(); len(pairs) != 1 || pairs[0] != "55.853551,-4.311093 -> destination" {
+		t.Errorf("Coordinates should be sent unchanged, got %v", pairs)
+	}
+
+	closeOrigin := Coordinates{Latitude: 55.853572, Longitude: -4.311081}
+	if _, err := api.GetDistancesWithOptions(context.Background(), []Location{closeOrigin}, destinations, Driving, nil); err != nil {
+		t.Fatal(err)
+	}
+	if pairs, _ := rec.reset(); len(pairs) != 0 {
+		t.Errorf("Close coordinates should have been cached, got %v", pairs)
+	}
+}
+
+func TestGetDistancesWithRequestQuantizer(t *testing.T) {
+	rec := &pairsRecorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithRequestQuantizer(PrecisionQuantizer{Digits: 4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origin := Coordinates{Latitude: 55.853551, Longitude: -4.311093}
+	if _, err := api.GetDistancesWithOptions(context.Background(), []Location{origin}, []Location{Address("destination")}, Driving, nil); err != nil {
+		t.Fatal(err)
+	}
+	if pairs, _ := rec.reset(); len(pairs) != 1 || pairs[0] != "55.8536,-4.3111 -> destination" {
+		t.Errorf("Coordinates should be rounded, got %v", pairs)
+	}
+}
+
+func TestInvalidQuantizers(t *testing.T) {
+	tests := []struct {
+		quantizer Quantizer
+		expected  error
+	}{
+		{nil, ErrNilQuantizer},
+		{PrecisionQuantizer{Digits: -1}, ErrInvalidQuantizer},
+		{PrecisionQuantizer{Digits: 16}, ErrInvalidQuantizer},
+		{PrecisionQuantizer{Digits: 400}, ErrInvalidQuantizer},
+		{GeohashQuantizer{}, ErrInvalidQuantizer},
+		{GeohashQuantizer{Precision: 13}, ErrInvalidQuantizer},
+		{PrecisionQuantizer{}, nil},
+		{PrecisionQuantizer{Digits: 15}, nil},
+		{GeohashQuantizer{Precision: 12}, nil},
+	}
+
+	for i, test := range tests {
+		if _, err := New(WithAPIKey("key"), WithCacheQuantizer(test.quantizer)); err != test.expected {
+			t.Errorf("Test %d: expected %v for the cache quantizer, got %v", i, test.expected, err)
+		}
+		if _, err := New(WithAPIKey("key"), WithRequestQuantizer(test.quantizer)); err != test.expected {
+			t.Errorf("Test %d: expected %v for the request quantizer, got %v", i, test.expected, err)
+		}
+	}
+}
+
+func TestPlanWithRequestQuantizer(t *testing.T) {
+	api, err := New(WithAPIKey("key"), WithRequestQuantizer(PrecisionQuantizer{Digits: 4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origins := []Location{Coordinates{Latitude: 55.853551, Longitude: -4.311093}}
+	destinations := []Location{Address("destination")}
+	plan, err := api.Plan(origins, destinations, Driving, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := plan.Calls[0]
+	if call.Origins[0] != (Coordinates{Latitude: 55.8536, Longitude: -4.3111}) {
+		t.Errorf("Planned origin should be rounded, got %v", call.Origins[0])
+	}
+	baseLength, _ := api.baseUrlLength(Driving, nil)
+	if call.UrlLength != baseLength+encodedLength(call.Origins, false)+encodedLength(destinations, false) {
+		t.Error("Url length should be the one of the rounded origin")
+	}
+}
@@ -0,0 +1,115 @@
+package gogoogledm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrDailyLimitExceeded = errors.New("elements per 24 hour period limit exceeded")
+
+// RateLimiter limits the number of elements sent to Google. A single
+// RateLimiter is shared by all the requests of a DistanceMatrixAPI, so it
+// must be safe for concurrent use.
+type RateLimiter interface {
+	// Wait blocks until elements can be sent. It returns an error if ctx is
+	// done first, or if the elements cannot be sent before its deadline.
+	Wait(ctx context.Context, elements int) error
+}
+
+// NewRateLimiter returns a token bucket RateLimiter allowing
+// elementsPerWindow elements per window, refilled continuously, and at most
+// elementsPerDay elements per 24 hour period, starting with the first
+// request. An elementsPerDay of 0 disables the daily limit.
+func NewRateLimiter(elementsPerWindow int, window time.Duration, elementsPerDay int) RateLimiter {
+	return &tokenBucketLimiter{
+		capacity:       float64(elementsPerWindow),
+		tokens:         float64(elementsPerWindow),
+		rate:           float64(elementsPerWindow) / float64(window),
+		elementsPerDay: elementsPerDay,
+		now:            time.Now,
+	}
+}
+
+type tokenBucketLimiter struct {
+	mu             sync.Mutex
+	capacity       float64
+	tokens         float64
+	rate           float64 // tokens per nanosecond
+	last           time.Time
+	elementsPerDay int
+	dayStart       time.Time
+	dayCount       int
+	now            func() time.Time
+}
+
+func (l *tokenBucketLimiter) Wait(ctx context.Context, elements int) error {
+	l.mu.Lock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = minFloat(l.capacity, l.tokens+float64(now.Sub(l.last))*l.rate)
+	}
+	l.last = now
+
+	if l.elementsPerDay > 0 {
+		if l.dayStart.IsZero() || now.Sub(l.dayStart) >= 24*time.Hour {
+			l.dayStart = now
+			l.dayCount = 0
+		}
+		if l.dayCount+elements > l.elementsPerDay {
+			l.mu.Unlock()
+			return ErrDailyLimitExceeded
+		}
+	}
+
+	// Calls larger than the bucket are sent once it is full
+	need := minFloat(l.capacity, float64(elements))
+	var delay time.Duration
+	if l.tokens < need {
+		delay = time.Duration((need - l.tokens) / l.rate)
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		l.mu.Unlock()
+		return ErrRateLimitExceedsDeadline
+	}
+
+	// The elements are reserved right away, so that concurrent callers queue
+	// up behind this one.
+	l.tokens -= float64(elements)
+	l.dayCount += elements
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	if err := wait(ctx, delay); err != nil {
+		l.mu.Lock()
+		l.tokens += float64(elements)
+		l.dayCount -= elements
+		l.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// wait waits for d, unless ctx is done first.
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func minFloat(a float64, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
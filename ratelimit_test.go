@@ -0,0 +1,84 @@
+package gogoogledm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterConcurrentCallers(t *testing.T) {
+	limiter := NewRateLimiter(10, 100*time.Millisecond, 0)
+
+	// 50 elements at 10 elements per 100ms, the first 10 are sent right away
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limiter.Wait(context.Background(), 5); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	if elapsed < 350*time.Millisecond {
+		t.Errorf("Concurrent callers exceeded the rate limit, took %s", elapsed)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("Rate limiter waited too long, took %s", elapsed)
+	}
+}
+
+func TestRateLimiterDailyLimit(t *testing.T) {
+	limiter := NewRateLimiter(100, time.Millisecond, 10)
+
+	if err := limiter.Wait(context.Background(), 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Wait(context.Background(), 6); err != ErrDailyLimitExceeded {
+		t.Errorf("Expected the daily limit to be exceeded, got %v", err)
+	}
+	if err := limiter.Wait(context.Background(), 4); err != nil {
+		t.Error("Elements within the daily limit should be allowed")
+	}
+}
+
+func TestRateLimiterDeadline(t *testing.T) {
+	limiter := NewRateLimiter(1, 10*time.Second, 0)
+	if err := limiter.Wait(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := limiter.Wait(ctx, 1); err != ErrRateLimitExceedsDeadline {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Error("Rate limiter should have failed fast")
+	}
+}
+
+func TestRateLimiterCancelReleasesElements(t *testing.T) {
+	limiter := NewRateLimiter(10, time.Second, 0).(*tokenBucketLimiter)
+	if err := limiter.Wait(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := limiter.Wait(ctx, 5); err != context.Canceled {
+		t.Fatalf("Expected a canceled error, got %v", err)
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if limiter.tokens < 0 {
+		t.Error("Cancelled elements should be released")
+	}
+}
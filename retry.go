@@ -0,0 +1,81 @@
+package gogoogledm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+var ErrInvalidRetryPolicy = errors.New("retry policy must allow at least one attempt, with non negative backoffs and a jitter between 0 and 1")
+
+// RetryPolicy configures how the calls failing with a transient error are
+// retried. Only the failed call is retried, not the whole request.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a call, the first one
+	// included. 1 disables the retries.
+	MaxAttempts int
+	// InitialBackoff is the time waited before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the time waited before a retry.
+	MaxBackoff time.Duration
+	// Multiplier is the factor applied to the backoff after each retry.
+	Multiplier float64
+	// Jitter is the fraction of the backoff that is randomized, between 0 and 1.
+	Jitter float64
+}
+
+// DefaultRetryPolicy retries a call up to 2 times, waiting around 500ms then 1s.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+var noRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+func (policy RetryPolicy) validate() error {
+	if policy.MaxAttempts < 1 || policy.InitialBackoff < 0 || policy.MaxBackoff < 0 || policy.Multiplier < 0 || policy.Jitter < 0 || policy.Jitter > 1 {
+		return ErrInvalidRetryPolicy
+	}
+	return nil
+}
+
+// backoff returns the time to wait before the given retry, starting at 1.
+func (policy RetryPolicy) backoff(retry int) time.Duration {
+	backoff := float64(policy.InitialBackoff) * math.Pow(policy.Multiplier, float64(retry-1))
+	if policy.MaxBackoff > 0 && backoff > float64(policy.MaxBackoff) {
+		backoff = float64(policy.MaxBackoff)
+	}
+	backoff -= backoff * policy.Jitter * rand.Float64()
+
+	return time.Duration(backoff)
+}
+
+// sendCall sends a planned call once the rate limiter allows it, retrying
+// it according to the retry policy.
+func (api *DistanceMatrixAPI) sendCall(ctx context.Context, call PlannedCall, transportMode TransportMode, opts *RequestOptions) (*ApiResponse, error) {
+	for attempt := 1; ; attempt++ {
+		if err := api.limiter.Wait(ctx, call.Elements); err != nil {
+			return nil, err
+		}
+
+		resp, err := api.sendRequest(ctx, call.ApiCall, transportMode, opts)
+		if err == nil || attempt >= api.retryPolicy.MaxAttempts || !IsRetryable(err) {
+			return resp, err
+		}
+
+		backoff := api.retryPolicy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return nil, err
+		}
+
+		api.logf("call at %d,%d failed: %v, retrying in %s", call.OriginOffset, call.DestinationOffset, err, backoff)
+		if err := wait(ctx, backoff); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package gogoogledm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransientErrors(t *testing.T) {
+	failures := []func(w http.ResponseWriter){
+		func(w http.ResponseWriter) { w.Write([]byte(`{"status": "UNKNOWN_ERROR"}`)) },
+		func(w http.ResponseWriter) { w.Write([]byte(`{"status": "OVER_QUERY_LIMIT"}`)) },
+		func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) },
+	}
+
+	for i, failure := range failures {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) < 3 {
+				failure(w)
+				return
+			}
+			distanceMatrixHandler(w, r)
+		}))
+
+		api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithRetryPolicy(RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Multiplier:     2,
+			Jitter:         0.5,
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = api.GetDistancesWithOptions(context.Background(), []Location{Address("Glasgow, UK")}, []Location{Address("Manchester, UK")}, Driving, nil)
+		if err != nil {
+			t.Errorf("Test %d: call should have been retried, got %v", i, err)
+		}
+		if atomic.LoadInt32(&requests) != 3 {
+			t.Errorf("Test %d: expected 3 requests, got %d", i, atomic.LoadInt32(&requests))
+		}
+		server.Close()
+	}
+}
+
+func TestRetryPermanentErrors(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"status": "REQUEST_DENIED"}`))
+	}))
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithRetryPolicy(DefaultRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.GetDistancesWithOptions(context.Background(), []Location{Address("Glasgow, UK")}, []Location{Address("Manchester, UK")}, Driving, nil)
+	if !errors.Is(err, ErrRequestDenied) {
+		t.Errorf("Expected a request denied error, got %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Error("Permanent errors should not be retried")
+	}
+}
+
+func TestRetryDisabledByDefault(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.GetDistancesWithOptions(context.Background(), []Location{Address("Glasgow, UK")}, []Location{Address("Manchester, UK")}, Driving, nil)
+	if !errors.Is(err, ErrServerError) {
+		t.Errorf("Expected a server error, got %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Error("Calls should not be retried by default")
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"status": "UNKNOWN_ERROR"}`))
+	}))
+	defer server.Close()
+
+	api, err := New(WithAPIKey("key"), WithBaseURL(server.URL), WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Minute,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = api.GetDistancesWithOptions(ctx, []Location{Address("Glasgow, UK")}, []Location{Address("Manchester, UK")}, Driving, nil)
+	if !errors.Is(err, ErrUnkownError) {
+		t.Errorf("Expected the last error once the backoff exceeds the deadline, got %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Error("Call should not be retried past the deadline")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		Multiplier:     2,
+	}
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	for i, e := range expected {
+		if backoff := policy.backoff(i + 1); backoff != e {
+			t.Errorf("Retry %d: expected %s, got %s", i+1, e, backoff)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if backoff := policy.backoff(1); backoff < 50*time.Millisecond || backoff > 100*time.Millisecond {
+			t.Fatalf("Jittered backoff %s out of bounds", backoff)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package gogoogledm
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store holds counters shared by all the replicas of a service, for instance
+// in Redis or Memcached. It must be safe for concurrent use.
+type Store interface {
+	// Increment atomically adds n, which may be negative, to the counter at
+	// key and returns its new value. A counter created by Increment starts
+	// at 0 and expires after ttl.
+	Increment(ctx context.Context, key string, n int, ttl time.Duration) (int, error)
+}
+
+// NewDistributedRateLimiter returns a RateLimiter coordinating the elements
+// sent by every replica using store. Elements are counted in fixed windows
+// of time, at most elementsPerWindow per window and elementsPerDay per UTC
+// day. An elementsPerDay of 0 disables the daily limit. The counters of the
+// store are prefixed with key, replicas sharing a Google key or client ID
+// must use the same one.
+func NewDistributedRateLimiter(store Store, key string, elementsPerWindow int, window time.Duration, elementsPerDay int) RateLimiter {
+	return &distributedLimiter{
+		store:             store,
+		key:               key,
+		elementsPerWindow: elementsPerWindow,
+		window:            window,
+		elementsPerDay:    elementsPerDay,
+		now:               time.Now,
+	}
+}
+
+type distributedLimiter struct {
+	store             Store
+	key               string
+	elementsPerWindow int
+	window            time.Duration
+	elementsPerDay    int
+	now               func() time.Time
+}
+
+func (l *distributedLimiter) Wait(ctx context.Context, elements int) error {
+	for {
+		now := l.now()
+		windowIndex := now.UnixNano() / int64(l.window)
+		windowKey := l.key + ":window:" + strconv.FormatInt(windowIndex, 10)
+
+		total, err := l.store.Increment(ctx, windowKey, elements, 2*l.window)
+		if err != nil {
+			return err
+		}
+
+		// Calls larger than the window are sent alone in a fresh one
+		if total <= l.elementsPerWindow || total == elements {
+			return l.reserveDay(ctx, now, windowKey, elements)
+		}
+
+		if _, err := l.store.Increment(ctx, windowKey, -elements, 2*l.window); err != nil {
+			return err
+		}
+
+		delay := time.Unix(0, (windowIndex+1)*int64(l.window)).Sub(now)
+		if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+			return ErrRateLimitExceedsDeadline
+		}
+		if err := wait(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// reserveDay counts elements in the daily limit, releasing them from the
+// window when the limit is exceeded.
+func (l *distributedLimiter) reserveDay(ctx context.Context, now time.Time, windowKey string, elements int) error {
+	if l.elementsPerDay <= 0 {
+		return nil
+	}
+
+	day := now.UTC().Unix() / int64(24*time.Hour/time.Second)
+	dayKey := l.key + ":day:" + strconv.FormatInt(day, 10)
+	total, err := l.store.Increment(ctx, dayKey, elements, 25*time.Hour)
+	if err != nil {
+		return err
+	}
+	if total <= l.elementsPerDay {
+		return nil
+	}
+
+	if _, err := l.store.Increment(ctx, dayKey, -elements, 25*time.Hour); err != nil {
+		return err
+	}
+	if _, err := l.store.Increment(ctx, windowKey, -elements, 2*l.window); err != nil {
+		return err
+	}
+
+	return ErrDailyLimitExceeded
+}
+
+// MemoryStore is a Store keeping its counters in memory. It only
+// coordinates the rate limiters of a single process, which is mostly useful
+// for testing.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]memoryCounter
+	now      func() time.Time
+}
+
+type memoryCounter struct {
+	value   int
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters: make(map[string]memoryCounter),
+		now:      time.Now,
+	}
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, n int, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, c := range s.counters {
+		if !now.Before(c.expires) {
+			delete(s.counters, k)
+		}
+	}
+
+	c, ok := s.counters[key]
+	if !ok {
+		c.expires = now.Add(ttl)
+	}
+	c.value += n
+	s.counters[key] = c
+
+	return c.value, nil
+}
@@ -0,0 +1,109 @@
+// Package storetest simulates several replicas of a service sharing a
+// gogoogledm.Store, to test distributed rate limiting in a single process.
+package storetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/heetch/gogoogledm"
+)
+
+// Cluster is a store shared by replicas reaching it through a network with
+// a fixed latency.
+type Cluster struct {
+	store   gogoogledm.Store
+	latency time.Duration
+
+	mu     sync.Mutex
+	totals map[string]int
+}
+
+// NewCluster returns a cluster whose replicas share store, and wait for
+// latency before each of their calls.
+func NewCluster(store gogoogledm.Store, latency time.Duration) *Cluster {
+	return &Cluster{
+		store:   store,
+		latency: latency,
+		totals:  make(map[string]int),
+	}
+}
+
+// Replica returns a new replica of the cluster.
+func (c *Cluster) Replica() *Replica {
+	return &Replica{cluster: c}
+}
+
+// Totals returns the sum of the increments applied by all the replicas to
+// each key. For a key of a rate limiter, it is the number of elements the
+// replicas were allowed to send, rolled back reservations excluded.
+func (c *Cluster) Totals() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	totals := make(map[string]int, len(c.totals))
+	for k, v := range c.totals {
+		totals[k] = v
+	}
+	return totals
+}
+
+// Replica is the view of the store of a single replica. It implements
+// gogoogledm.Store.
+type Replica struct {
+	cluster *Cluster
+
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+// Increment waits for the latency of the cluster, then increments the
+// counter in the shared store, unless an error is set on the replica.
+func (r *Replica) Increment(ctx context.Context, key string, n int, ttl time.Duration) (int, error) {
+	r.mu.Lock()
+	r.calls++
+	err := r.err
+	r.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if r.cluster.latency > 0 {
+		timer := time.NewTimer(r.cluster.latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	value, err := r.cluster.store.Increment(ctx, key, n, ttl)
+	if err != nil {
+		return 0, err
+	}
+
+	r.cluster.mu.Lock()
+	r.cluster.totals[key] += n
+	r.cluster.mu.Unlock()
+
+	return value, nil
+}
+
+// SetError makes every following call of the replica fail with err, for
+// instance to simulate a network partition. A nil err restores the replica.
+func (r *Replica) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// Calls returns the number of calls made by the replica.
+func (r *Replica) Calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
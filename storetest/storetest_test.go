@@ -0,0 +1,92 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heetch/gogoogledm"
+)
+
+func TestReplicasShareTheRateLimit(t *testing.T) {
+	cluster := NewCluster(gogoogledm.NewMemoryStore(), time.Millisecond)
+
+	const elementsPerWindow = 25
+	window := 50 * time.Millisecond
+
+	// 5 replicas sending 150 elements at 25 elements per 50ms
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		limiter := gogoogledm.NewDistributedRateLimiter(cluster.Replica(), "key", elementsPerWindow, window, 0)
+		for j := 0; j < 3; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < 2; k++ {
+					if err := limiter.Wait(context.Background(), 5); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if time.Since(start) < 4*window {
+		t.Error("Replicas exceeded the rate limit")
+	}
+
+	sent := 0
+	for key, total := range cluster.Totals() {
+		if !strings.HasPrefix(key, "key:window:") {
+			continue
+		}
+		if total > elementsPerWindow {
+			t.Errorf("%d elements sent in window %s", total, key)
+		}
+		sent += total
+	}
+	if sent != 150 {
+		t.Errorf("Expected 150 elements sent, got %d", sent)
+	}
+}
+
+func TestReplicasShareTheDailyLimit(t *testing.T) {
+	cluster := NewCluster(gogoogledm.NewMemoryStore(), 0)
+	first := gogoogledm.NewDistributedRateLimiter(cluster.Replica(), "key", 100, time.Millisecond, 10)
+	second := gogoogledm.NewDistributedRateLimiter(cluster.Replica(), "key", 100, time.Millisecond, 10)
+
+	if err := first.Wait(context.Background(), 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Wait(context.Background(), 6); err != gogoogledm.ErrDailyLimitExceeded {
+		t.Errorf("Expected the daily limit to be exceeded, got %v", err)
+	}
+	if err := second.Wait(context.Background(), 4); err != nil {
+		t.Error("Elements within the daily limit should be allowed")
+	}
+}
+
+func TestReplicaError(t *testing.T) {
+	cluster := NewCluster(gogoogledm.NewMemoryStore(), 0)
+	replica := cluster.Replica()
+	limiter := gogoogledm.NewDistributedRateLimiter(replica, "key", 100, time.Second, 0)
+
+	errPartition := errors.New("partition")
+	replica.SetError(errPartition)
+	if err := limiter.Wait(context.Background(), 1); err != errPartition {
+		t.Errorf("Expected the store error, got %v", err)
+	}
+
+	replica.SetError(nil)
+	if err := limiter.Wait(context.Background(), 1); err != nil {
+		t.Error(err)
+	}
+	if replica.Calls() != 2 {
+		t.Error("Calls are not counted")
+	}
+}
@@ -2,6 +2,9 @@ package gogoogledm
 
 import (
 	"fmt"
+	"log"
+	"net/http"
+	"strings"
 	"time"
 )
 
@@ -9,38 +12,99 @@ type DistanceMatrixAPI struct {
 	apiKey                string
 	clientID              string
 	cryptoKey             []byte
+	channel               string
 	maxElementsPerRequest int
-	timeToWait            time.Duration
+	elementsPerWindow     int
+	window                time.Duration
+	elementsPerDay        int
+	limiter               RateLimiter
+	store                 Store
+	storeKey              string
+	retryPolicy           RetryPolicy
+	concurrency           int
+	cache                 Cache
+	cacheTTL              time.Duration
+	trafficCacheTTL       time.Duration
+	hasTrafficCacheTTL    bool
+	departureSlot         time.Duration
+	departureLocation     *time.Location
+	cacheQuantizer        Quantizer
+	requestQuantizer      Quantizer
 	languageCode          string
 	unitSystem            UnitSystem
+	httpClient            *http.Client
+	baseURL               string
+	logger                *log.Logger
 }
 
 type ApiResponse struct {
 	DestinationAddresses []string `json:"destination_addresses"`
 	OriginAddresses      []string `json:"origin_addresses"`
-	Rows                 []struct {
-		Elements []struct {
-			Distance struct {
-				Text  string
-				Value float64
-			}
-			Duration struct {
-				Text  string
-				Value float64
-			}
-			Fare struct {
-				Currency string
-				Value    float64
-			}
-			Status string
-		}
+	Rows                 []ApiRow
+	Status               string
+	// ErrorMessage details the status when the request failed
+	ErrorMessage string `json:"error_message"`
+}
+
+type ApiRow struct {
+	Elements []ApiElement
+}
+
+type ApiElement struct {
+	Distance struct {
+		Text  string
+		Value float64
+	}
+	Duration struct {
+		Text  string
+		Value float64
+	}
+	// DurationInTraffic is only returned for driving requests with a departure time
+	DurationInTraffic struct {
+		Text  string
+		Value float64
+	} `json:"duration_in_traffic"`
+	Fare struct {
+		Currency string
+		Value    float64
 	}
 	Status string
 }
 
 type ApiCall struct {
-	Origins      []Coordinates
-	Destinations []Coordinates
+	Origins      []Location
+	Destinations []Location
+	// OriginOffset and DestinationOffset are the indexes of the first origin
+	// and destination of the call in the full request.
+	OriginOffset      int
+	DestinationOffset int
+}
+
+// QueryPlan describes the calls sent for a request, without sending them.
+type QueryPlan struct {
+	Calls []PlannedCall
+	// Elements is the estimated number of billable elements, one per origin
+	// and destination pair.
+	Elements int
+	// Advanced is true when the elements are billed at the advanced rate,
+	// which applies to requests using traffic information.
+	Advanced bool
+	// ExpectedWait is the total time spent waiting for the rate limit.
+	ExpectedWait time.Duration
+}
+
+type PlannedCall struct {
+	ApiCall
+	Elements  int
+	UrlLength int
+	// Wait is the time waited for the rate limit before sending the call.
+	Wait time.Duration
+}
+
+// Location is an origin or a destination. String returns the form in which
+// it is sent to Google.
+type Location interface {
+	String() string
 }
 
 type Coordinates struct {
@@ -52,6 +116,38 @@ func (coordinates Coordinates) String() string {
 	return fmt.Sprintf("%v,%v", coordinates.Latitude, coordinates.Longitude)
 }
 
+// LocationsFromCoordinates converts a slice of coordinates to a slice of locations.
+func LocationsFromCoordinates(coordinates []Coordinates) []Location {
+	locations := make([]Location, len(coordinates))
+	for i, c := range coordinates {
+		locations[i] = c
+	}
+
+	return locations
+}
+
+// Address is a street address or place name that Google geocodes.
+type Address string
+
+func (address Address) String() string {
+	return string(address)
+}
+
+// PlaceID is a Google place ID, such as the ones returned by the Places
+// Autocomplete API.
+type PlaceID string
+
+func (placeID PlaceID) String() string {
+	return "place_id:" + string(placeID)
+}
+
+// PlusCode is a global or compound plus code.
+type PlusCode string
+
+func (plusCode PlusCode) String() string {
+	return string(plusCode)
+}
+
 type UnitSystem int
 
 const (
@@ -103,3 +199,97 @@ var transportModes = []string{
 func (transportMode TransportMode) String() string {
 	return transportModes[transportMode-1]
 }
+
+type TrafficModel int
+
+const (
+	BestGuess TrafficModel = 1 + iota
+	Pessimistic
+	Optimistic
+)
+
+var trafficModels = []string{
+	"best_guess",
+	"pessimistic",
+	"optimistic",
+}
+
+func (trafficModel TrafficModel) String() string {
+	return trafficModels[trafficModel-1]
+}
+
+// Avoid is a set of route restrictions. Values can be combined, for
+// instance Tolls|Ferries.
+type Avoid int
+
+const (
+	Tolls Avoid = 1 << iota
+	Highways
+	Ferries
+	Indoor
+)
+
+var avoids = []string{
+	"tolls",
+	"highways",
+	"ferries",
+	"indoor",
+}
+
+func (avoid Avoid) String() string {
+	var restrictions []string
+	for i, a := range avoids {
+		if avoid&(1<<uint(i)) != 0 {
+			restrictions = append(restrictions, a)
+		}
+	}
+
+	return strings.Join(restrictions, "|")
+}
+
+// TransitMode is a set of preferred modes of transit. Values can be
+// combined, for instance Bus|Tram.
+type TransitMode int
+
+const (
+	Bus TransitMode = 1 << iota
+	Subway
+	Train
+	Tram
+	Rail
+)
+
+var transitModes = []string{
+	"bus",
+	"subway",
+	"train",
+	"tram",
+	"rail",
+}
+
+func (transitMode TransitMode) String() string {
+	var modes []string
+	for i, m := range transitModes {
+		if transitMode&(1<<uint(i)) != 0 {
+			modes = append(modes, m)
+		}
+	}
+
+	return strings.Join(modes, "|")
+}
+
+type TransitRoutingPreference int
+
+const (
+	LessWalking TransitRoutingPreference = 1 + iota
+	FewerTransfers
+)
+
+var transitRoutingPreferences = []string{
+	"less_walking",
+	"fewer_transfers",
+}
+
+func (transitRoutingPreference TransitRoutingPreference) String() string {
+	return transitRoutingPreferences[transitRoutingPreference-1]
+}